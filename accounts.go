@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	accountStatementLatency = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_account_statement_latency_seconds_total",
+			Help: "Total time spent executing statements per account since server start, for the accounts with the most statement time.",
+		},
+		labelNames("user", "host"),
+	)
+	accountStatements = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_account_statements_total",
+			Help: "Number of statements executed per account since server start, for the accounts with the most statement time.",
+		},
+		labelNames("user", "host"),
+	)
+	userAccounts = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_user_accounts",
+			Help: "Number of user accounts defined in mysql.user.",
+		},
+		labelNames(),
+	)
+	userAccountsLocked = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_user_accounts_locked",
+			Help: "Number of user accounts that are locked.",
+		},
+		labelNames(),
+	)
+	userAccountsExpiredPassword = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_user_accounts_expired_password",
+			Help: "Number of user accounts whose password is marked expired.",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(accountStatementLatency)
+	mustRegisterVec(accountStatements)
+	mustRegisterVec(userAccounts)
+	mustRegisterVec(userAccountsLocked)
+	mustRegisterVec(userAccountsExpiredPassword)
+}
+
+// AccountsConfig configures per-account statement statistics
+type AccountsConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// TopAccounts limits the metrics to the accounts with the most statement
+	// time. Defaults to 20.
+	TopAccounts int `yaml:"top_accounts"`
+}
+
+func (c AccountsConfig) topAccounts() int {
+	if c.TopAccounts <= 0 {
+		return 20
+	}
+	return c.TopAccounts
+}
+
+func collectAccounts(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	// SUM_TIMER_WAIT is in picoseconds. Background threads have a NULL user
+	// and host and are grouped together.
+	rows, err := db.Query(`
+		SELECT user, host, SUM(count_star), SUM(sum_timer_wait) / 1e12 AS latency
+		FROM performance_schema.events_statements_summary_by_account_by_event_name
+		GROUP BY user, host
+		ORDER BY latency DESC
+		LIMIT ?
+	`, dbConfig.Accounts.topAccounts())
+	if err != nil {
+		if isMissingObjectError(err) {
+			logOnce("accounts-missing:"+cloudName, "database %s: performance_schema account statistics not available, skipping accounts", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing account statistics query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	// Accounts drop out of the top N, so only the current ones are exported
+	accountStatementLatency.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	accountStatements.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+
+	for rows.Next() {
+		var user, host sql.NullString
+		var statements, latency sql.NullFloat64
+
+		if err := rows.Scan(&user, &host, &statements, &latency); err != nil {
+			log.Printf("database %s: Error scanning account statistics row: %v", cloudName, err)
+			continue
+		}
+
+		userName := user.String
+		if !user.Valid {
+			userName = "BACKGROUND"
+		} else if userName == "" {
+			userName = "ANONYMOUS"
+		}
+		hostName := host.String
+		if !host.Valid || hostName == "" {
+			hostName = "UNKNOWN_HOST"
+		}
+
+		accountStatementLatency.set(dbConfig.labelValues(userName, hostName), latency.Float64)
+		accountStatements.set(dbConfig.labelValues(userName, hostName), statements.Float64)
+	}
+}
+
+// collectUserAccounts counts the accounts in mysql.user, which needs SELECT
+// on mysql.user
+func collectUserAccounts(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	var total, locked, expired float64
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(account_locked = 'Y'), 0), COALESCE(SUM(password_expired = 'Y'), 0)
+		FROM mysql.user
+	`).Scan(&total, &locked, &expired)
+	if err != nil {
+		if isAccessDeniedError(err) {
+			logOnce("user-accounts-denied:"+cloudName, "database %s: no SELECT privilege on mysql.user, skipping user accounts", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing user accounts query: %v", cloudName, err)
+		return
+	}
+
+	userAccounts.WithLabelValues(dbConfig.labelValues()...).Set(total)
+	userAccountsLocked.WithLabelValues(dbConfig.labelValues()...).Set(locked)
+	userAccountsExpiredPassword.WithLabelValues(dbConfig.labelValues()...).Set(expired)
+}
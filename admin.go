@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+var collectionPaused = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_collection_paused",
+		Help: "Whether collection for the database is paused via the admin API (1) or running (0).",
+	},
+	labelNames(),
+)
+
+var collectionProfile = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_collection_profile",
+		Help: "Collector profile of the database set via the admin API, value is always 1.",
+	},
+	labelNames("profile"),
+)
+
+func init() {
+	mustRegisterVec(collectionPaused)
+	mustRegisterVec(collectionProfile)
+}
+
+// BasicAuthConfig protects the HTTP endpoints with basic auth when a username is set
+type BasicAuthConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// withBasicAuth wraps handler with basic auth if it is configured
+func withBasicAuth(auth BasicAuthConfig, handler http.Handler) http.Handler {
+	if auth.Username == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(username), []byte(auth.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(auth.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mysql_info_exporter"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// pauseRegistry tracks which databases have collection paused
+type pauseRegistry struct {
+	mu        sync.RWMutex
+	databases map[string]DatabaseConfig
+	paused    map[string]bool
+}
+
+var pauses = &pauseRegistry{
+	databases: make(map[string]DatabaseConfig),
+	paused:    make(map[string]bool),
+}
+
+// add registers a database so it can be paused
+func (p *pauseRegistry) add(dbConfig DatabaseConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.databases[dbConfig.Name] = dbConfig
+	collectionPaused.WithLabelValues(dbConfig.labelValues()...).Set(0)
+}
+
+// remove forgets a database that is no longer collected
+func (p *pauseRegistry) remove(cloudName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.databases, cloudName)
+	delete(p.paused, cloudName)
+}
+
+func (p *pauseRegistry) isPaused(cloudName string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.paused[cloudName]
+}
+
+// set pauses or resumes a database, reporting false if it is unknown
+func (p *pauseRegistry) set(cloudName string, paused bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dbConfig, ok := p.databases[cloudName]
+	if !ok {
+		return false
+	}
+	p.paused[cloudName] = paused
+	value := 0.0
+	if paused {
+		value = 1
+	}
+	collectionPaused.WithLabelValues(dbConfig.labelValues()...).Set(value)
+	return true
+}
+
+// pauseHandler serves /admin/pause and /admin/resume
+func pauseHandler(paused bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		if !pauses.set(name, paused) {
+			http.Error(w, fmt.Sprintf("unknown database %q", name), http.StatusNotFound)
+			return
+		}
+		if paused {
+			fmt.Fprintf(w, "database %s: collection paused\n", name)
+		} else {
+			fmt.Fprintf(w, "database %s: collection resumed\n", name)
+		}
+	})
+}
+
+// Collector profiles. The verbose profile also runs the optional collectors
+// marked verbose that the config leaves disabled.
+const (
+	profileDefault = "default"
+	profileVerbose = "verbose"
+)
+
+// profileRegistry tracks the collector profile of each database. Profiles
+// are not persisted, so every database starts with the default profile.
+type profileRegistry struct {
+	mu        sync.RWMutex
+	databases map[string]DatabaseConfig
+	verbose   map[string]bool
+}
+
+var profiles = &profileRegistry{
+	databases: make(map[string]DatabaseConfig),
+	verbose:   make(map[string]bool),
+}
+
+// add registers a database with the default profile
+func (p *profileRegistry) add(dbConfig DatabaseConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.databases[dbConfig.Name] = dbConfig
+	collectionProfile.WithLabelValues(dbConfig.labelValues(profileDefault)...).Set(1)
+}
+
+// remove forgets a database that is no longer collected
+func (p *profileRegistry) remove(cloudName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.databases, cloudName)
+	delete(p.verbose, cloudName)
+}
+
+func (p *profileRegistry) isVerbose(cloudName string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.verbose[cloudName]
+}
+
+// set changes the profile of a database, reporting false if it is unknown
+func (p *profileRegistry) set(cloudName string, profile string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dbConfig, ok := p.databases[cloudName]
+	if !ok {
+		return false
+	}
+	p.verbose[cloudName] = profile == profileVerbose
+	collectionProfile.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	collectionProfile.WithLabelValues(dbConfig.labelValues(profile)...).Set(1)
+	return true
+}
+
+// profileHandler serves /admin/profile, switching a database between the
+// default and verbose collector profiles
+func profileHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		level := r.URL.Query().Get("level")
+		if level != profileDefault && level != profileVerbose {
+			http.Error(w, fmt.Sprintf("unknown level %q, expected %s or %s", level, profileDefault, profileVerbose), http.StatusBadRequest)
+			return
+		}
+		if !profiles.set(name, level) {
+			http.Error(w, fmt.Sprintf("unknown database %q", name), http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, "database %s: collector profile set to %s\n", name, level)
+	})
+}
+
+// redactConfig returns a copy of config safe to show: DSN passwords are
+// masked with redactDSN and the basic auth password is removed
+func redactConfig(config Config) Config {
+	if config.BasicAuth.Password != "" {
+		config.BasicAuth.Password = "***"
+	}
+	if config.Defaults.DSN != "" {
+		config.Defaults.DSN = redactDSN(config.Defaults.DSN)
+	}
+	databases := make([]DatabaseConfig, len(config.Databases))
+	for i, dbConfig := range config.Databases {
+		dbConfig.DSN = redactDSN(dbConfig.DSN)
+		databases[i] = dbConfig
+	}
+	config.Databases = databases
+	discoveries := make([]SRVDiscoveryConfig, len(config.SRVDiscovery))
+	for i, discovery := range config.SRVDiscovery {
+		discovery.Database.DSN = redactDSN(discovery.Database.DSN)
+		discoveries[i] = discovery
+	}
+	config.SRVDiscovery = discoveries
+	return config
+}
+
+// configHandler serves /config, the running config with defaults merged in
+// and secrets redacted, as YAML. Databases are shown as last reloaded.
+func configHandler(current func() Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		out, err := yaml.Marshal(redactConfig(current()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error encoding config: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(out)
+	})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ahiEnabled = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_innodb_ahi_enabled",
+			Help: "Whether the InnoDB adaptive hash index is enabled (innodb_adaptive_hash_index).",
+		},
+		labelNames(),
+	)
+	ahiSearches = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_innodb_ahi_searches_per_sec",
+			Help: "Searches per second answered by the InnoDB adaptive hash index.",
+		},
+		labelNames(),
+	)
+	ahiNonHashSearches = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_innodb_ahi_non_hash_searches_per_sec",
+			Help: "Searches per second that could not use the InnoDB adaptive hash index and searched the B-tree.",
+		},
+		labelNames(),
+	)
+	ahiHashTableSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_innodb_ahi_hash_table_size",
+			Help: "Number of cells of the InnoDB adaptive hash index hash tables, summed over its partitions (SHOW ENGINE INNODB STATUS).",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(ahiEnabled)
+	mustRegisterVec(ahiSearches)
+	mustRegisterVec(ahiNonHashSearches)
+	mustRegisterVec(ahiHashTableSize)
+}
+
+var (
+	ahiHashTableLine = regexp.MustCompile(`(?m)^Hash table size (\d+)`)
+	ahiSearchesLine  = regexp.MustCompile(`(?m)^([\d.]+) hash searches/s, ([\d.]+) non-hash searches/s`)
+)
+
+// ahiCounts are the adaptive_hash_searches and adaptive_hash_searches_btree
+// counters of innodb_metrics, read at a given time
+type ahiCounts struct {
+	at            time.Time
+	hash, nonHash float64
+}
+
+// Counters seen at the previous collection, keyed by cloud_name
+var (
+	lastAHICountsMu sync.Mutex
+	lastAHICounts   = make(map[string]ahiCounts)
+)
+
+// collectAdaptiveHashIndex exports how much the adaptive hash index is used,
+// to tell whether it is worth its latch contention. The search rates come
+// from the innodb_metrics counters when they are enabled (the default), and
+// otherwise from SHOW ENGINE INNODB STATUS. The hash table size is only in
+// SHOW ENGINE INNODB STATUS, which needs the PROCESS privilege. Nothing is
+// queried while the adaptive hash index is disabled.
+func collectAdaptiveHashIndex(s *snapshot) {
+	db, dbConfig := s.queryer(), s.dbConfig
+	cloudName := dbConfig.Name
+	labels := dbConfig.labelValues()
+
+	variables, _ := s.globalVariables()
+	enabled, ok := variables["innodb_adaptive_hash_index"]
+	if !ok {
+		logOnce("ahi-missing:"+cloudName, "database %s: innodb_adaptive_hash_index not available, skipping adaptive_hash_index", cloudName)
+		return
+	}
+	if enabled != "ON" {
+		ahiEnabled.WithLabelValues(labels...).Set(0)
+		ahiSearches.DeleteLabelValues(labels...)
+		ahiNonHashSearches.DeleteLabelValues(labels...)
+		ahiHashTableSize.DeleteLabelValues(labels...)
+		// The rates restart from the next collection once it is enabled
+		lastAHICountsMu.Lock()
+		delete(lastAHICounts, cloudName)
+		lastAHICountsMu.Unlock()
+		return
+	}
+	ahiEnabled.WithLabelValues(labels...).Set(1)
+
+	fromMetrics := collectAHIMetrics(db, dbConfig)
+
+	var typ, name, status string
+	err := db.QueryRow("SHOW ENGINE INNODB STATUS").Scan(&typ, &name, &status)
+	if isAccessDeniedError(err) {
+		logOnce("ahi-status-denied:"+cloudName, "database %s: no PROCESS privilege for SHOW ENGINE INNODB STATUS, skipping the adaptive hash index size", cloudName)
+		return
+	}
+	if err != nil {
+		log.Printf("database %s: Error executing SHOW ENGINE INNODB STATUS: %v", cloudName, err)
+		return
+	}
+	section := parseInnodbStatus(status)["INSERT BUFFER AND ADAPTIVE HASH INDEX"]
+
+	// One line per partition (innodb_adaptive_hash_index_parts)
+	size, found := 0.0, false
+	for _, match := range ahiHashTableLine.FindAllStringSubmatch(section, -1) {
+		if cells, err := strconv.ParseFloat(match[1], 64); err == nil {
+			size += cells
+			found = true
+		}
+	}
+	if found {
+		ahiHashTableSize.WithLabelValues(labels...).Set(size)
+	}
+
+	// The status rates are averaged since the previous InnoDB monitor
+	// output, by this or any other client
+	if match := ahiSearchesLine.FindStringSubmatch(section); match != nil && !fromMetrics {
+		hash, _ := strconv.ParseFloat(match[1], 64)
+		nonHash, _ := strconv.ParseFloat(match[2], 64)
+		ahiSearches.WithLabelValues(labels...).Set(hash)
+		ahiNonHashSearches.WithLabelValues(labels...).Set(nonHash)
+	}
+}
+
+// collectAHIMetrics sets the search rates from the innodb_metrics counters
+// since the previous collection, and reports whether both counters are
+// available
+func collectAHIMetrics(db queryer, dbConfig DatabaseConfig) bool {
+	cloudName := dbConfig.Name
+
+	rows, err := db.Query(`
+		SELECT name, count
+		FROM information_schema.innodb_metrics
+		WHERE name IN ('adaptive_hash_searches', 'adaptive_hash_searches_btree') AND status = 'enabled'
+	`)
+	if err != nil {
+		if !isMissingObjectError(err) {
+			log.Printf("database %s: Error executing adaptive hash index metrics query: %v", cloudName, err)
+		}
+		return false
+	}
+	defer rows.Close()
+
+	current := ahiCounts{at: time.Now()}
+	found := 0
+	for rows.Next() {
+		var name string
+		var count float64
+		if err := rows.Scan(&name, &count); err != nil {
+			log.Printf("database %s: Error scanning adaptive hash index metrics row: %v", cloudName, err)
+			return false
+		}
+		switch name {
+		case "adaptive_hash_searches":
+			current.hash = count
+		case "adaptive_hash_searches_btree":
+			current.nonHash = count
+		}
+		found++
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing adaptive hash index metrics query: %v", cloudName, err)
+		return false
+	}
+	if found < 2 {
+		return false
+	}
+
+	lastAHICountsMu.Lock()
+	previous, ok := lastAHICounts[cloudName]
+	lastAHICounts[cloudName] = current
+	lastAHICountsMu.Unlock()
+
+	// The first collection has no rate yet. Counters that decreased were
+	// reset, by a restart or innodb_monitor_reset.
+	elapsed := current.at.Sub(previous.at).Seconds()
+	if ok && elapsed > 0 && current.hash >= previous.hash && current.nonHash >= previous.nonHash {
+		labels := dbConfig.labelValues()
+		ahiSearches.WithLabelValues(labels...).Set((current.hash - previous.hash) / elapsed)
+		ahiNonHashSearches.WithLabelValues(labels...).Set((current.nonHash - previous.nonHash) / elapsed)
+	}
+	return true
+}
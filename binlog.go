@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	binlogBytesWritten = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_binlog_bytes_written_total",
+			Help: "Number of bytes written to the binary log since server start (Binlog_bytes_written, MariaDB and some forks only).",
+		},
+		labelNames(),
+	)
+	masterBinlogPosition = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_master_binlog_position",
+			Help: "Current write position in the binary log file (SHOW BINARY LOG STATUS), in bytes.",
+		},
+		labelNames("file"),
+	)
+)
+
+func init() {
+	mustRegisterVec(binlogBytesWritten)
+	mustRegisterVec(masterBinlogPosition)
+}
+
+// collectBinlog exports how far the server has written its binary log. The
+// position needs the REPLICATION CLIENT privilege.
+func collectBinlog(s *snapshot) {
+	dbConfig := s.dbConfig
+	cloudName := dbConfig.Name
+
+	// global_status already logged a failed status query
+	if status, err := s.globalStatus(); err == nil {
+		if written, err := strconv.ParseFloat(status["Binlog_bytes_written"], 64); err == nil {
+			binlogBytesWritten.set(dbConfig.labelValues(), written)
+		}
+	}
+
+	// SHOW MASTER STATUS was replaced by SHOW BINARY LOG STATUS in MySQL 8.2
+	row, err := queryFirstRow(s.queryer(), "SHOW BINARY LOG STATUS", "SHOW MASTER STATUS")
+	if err != nil {
+		if isAccessDeniedError(err) {
+			logOnce("binlog-denied:"+cloudName, "database %s: no REPLICATION CLIENT privilege, skipping binary log position", cloudName)
+			return
+		}
+		log.Printf("database %s: Error reading binary log status: %v", cloudName, err)
+		return
+	}
+
+	// The file changes on rotation, and binary logging may be off
+	masterBinlogPosition.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	if row == nil {
+		logOnce("binlog-disabled:"+cloudName, "database %s: binary logging is disabled, skipping binary log position", cloudName)
+		return
+	}
+	if pos, err := strconv.ParseFloat(row["position"], 64); err == nil {
+		masterBinlogPosition.WithLabelValues(dbConfig.labelValues(row["file"])...).Set(pos)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mysqlUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_up",
+			Help: "Whether the last health check of the MySQL server succeeded (1) or failed (0).",
+		},
+		labelNames(),
+	)
+	circuitOpen = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_circuit_open",
+			Help: "Whether collection is suspended after repeated health check failures (1) or running (0).",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(mysqlUp)
+	mustRegisterVec(circuitOpen)
+}
+
+// CircuitBreakerConfig suspends collection from a database after
+// FailureThreshold consecutive failed health checks, probing it again every
+// RetryInterval until it recovers. Disabled when FailureThreshold is zero.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold"`
+	RetryInterval    time.Duration `yaml:"retry_interval"`
+}
+
+func (c CircuitBreakerConfig) retryInterval() time.Duration {
+	if c.RetryInterval <= 0 {
+		return 30 * time.Minute
+	}
+	return c.RetryInterval
+}
+
+// ReconnectConfig sets the backoff between health checks while a database is
+// unreachable. Collection waits for a successful health check, so these are
+// the reconnection attempts.
+type ReconnectConfig struct {
+	BaseDelay time.Duration `yaml:"base_delay"`
+	MaxDelay  time.Duration `yaml:"max_delay"`
+}
+
+// backoff returns the delay before reconnection attempt number attempt
+// (starting at 1), using full jitter: random(0, min(max, base*2^attempt)).
+// The randomness spreads out the reconnects of databases that failed together.
+func (c ReconnectConfig) backoff(attempt int) time.Duration {
+	ceiling := int64(c.ceiling(attempt))
+	if ceiling == math.MaxInt64 {
+		return time.Duration(rand.Int63())
+	}
+	return time.Duration(rand.Int63n(ceiling + 1))
+}
+
+// ceiling returns min(max, base*2^attempt), the longest backoff of the
+// attempt. Comparing base with max shifted right cannot overflow, and
+// shifts of 64 or more give 0.
+func (c ReconnectConfig) ceiling(attempt int) time.Duration {
+	base, max := c.BaseDelay, c.MaxDelay
+	if base <= 0 {
+		base = time.Second
+	}
+	if max <= 0 {
+		max = time.Minute
+	}
+	if max < base {
+		return max
+	}
+	if attempt < 0 {
+		attempt = 0
+	}
+	if base <= max>>uint(attempt) {
+		return base << uint(attempt)
+	}
+	return max
+}
+
+type breakerState struct {
+	failures  int
+	open      bool
+	nextProbe time.Time
+}
+
+// breakerRegistry holds the circuit breaker state of each database
+type breakerRegistry struct {
+	mu     sync.Mutex
+	states map[string]*breakerState
+}
+
+var breakers = &breakerRegistry{states: make(map[string]*breakerState)}
+
+func (b *breakerRegistry) state(cloudName string) *breakerState {
+	state, ok := b.states[cloudName]
+	if !ok {
+		state = &breakerState{}
+		b.states[cloudName] = state
+	}
+	return state
+}
+
+// isSuspended reports whether collection from the database is suspended,
+// either because its circuit breaker is open or until a health check
+// succeeds after the last failure
+func (b *breakerRegistry) isSuspended(cloudName string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.state(cloudName)
+	return state.open || state.failures > 0
+}
+
+// failures returns the number of consecutive failed health checks
+func (b *breakerRegistry) failures(cloudName string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state(cloudName).failures
+}
+
+// shouldProbe reports whether a health check should run now: always while
+// the breaker is closed, and once per retry interval while it is open
+func (b *breakerRegistry) shouldProbe(cloudName string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.state(cloudName)
+	return !state.open || !time.Now().Before(state.nextProbe)
+}
+
+// record updates the breaker with the result of a health check
+func (b *breakerRegistry) record(dbConfig DatabaseConfig, err error) {
+	cfg := dbConfig.CircuitBreaker
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.state(dbConfig.Name)
+
+	if err == nil {
+		if state.open {
+			log.Printf("database %s: Health check succeeded, closing circuit breaker", dbConfig.Name)
+		}
+		if state.failures > 0 {
+			// The connections were re-established and may reach another server
+			forgetIdentity(dbConfig.Name)
+		}
+		state.failures = 0
+		state.open = false
+	} else {
+		state.failures++
+		if state.open {
+			state.nextProbe = time.Now().Add(cfg.retryInterval())
+		} else if cfg.FailureThreshold > 0 && state.failures >= cfg.FailureThreshold {
+			log.Printf("database %s: %d consecutive health check failures, opening circuit breaker for %s: %v",
+				dbConfig.Name, state.failures, cfg.retryInterval(), err)
+			state.open = true
+			state.nextProbe = time.Now().Add(cfg.retryInterval())
+		} else {
+			log.Printf("database %s: Health check failed: %v", dbConfig.Name, err)
+		}
+	}
+
+	open := 0.0
+	if state.open {
+		open = 1
+	}
+	circuitOpen.WithLabelValues(dbConfig.labelValues()...).Set(open)
+}
+
+// Default bound of the ping query, well within the minute between health
+// checks, so that a server that accepts connections but hangs is marked down
+const defaultPingTimeout = 10 * time.Second
+
+func (c DatabaseConfig) pingTimeout() time.Duration {
+	if c.PingTimeout > 0 {
+		return c.PingTimeout
+	}
+	return defaultPingTimeout
+}
+
+// ping runs the ping query of the database and discards its result. Backends
+// that are only partly MySQL-compatible may not answer a driver ping like
+// MySQL does, so a query known to work on them can be configured instead.
+func ping(db *sql.DB, dbConfig DatabaseConfig) error {
+	query := dbConfig.PingQuery
+	if query == "" {
+		query = "SELECT 1"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbConfig.pingTimeout())
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// runHealthCheck runs the ping query every interval until done is closed,
+// updating mysql_up and the circuit breaker. After a failure it retries with
+// a jittered backoff instead.
+func runHealthCheck(db *sql.DB, dbConfig DatabaseConfig, interval time.Duration, done <-chan struct{}) {
+	for {
+		if !pauses.isPaused(dbConfig.Name) && breakers.shouldProbe(dbConfig.Name) {
+			err := ping(db, dbConfig)
+			up := 1.0
+			if err != nil {
+				up = 0
+			}
+			mysqlUp.WithLabelValues(dbConfig.labelValues()...).Set(up)
+			breakers.record(dbConfig, err)
+		}
+
+		delay := interval
+		if failures := breakers.failures(dbConfig.Name); failures > 0 {
+			delay = dbConfig.Reconnect.backoff(failures)
+		}
+		if !sleep(delay, done) {
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoffBounds(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		config      ReconnectConfig
+		attempt     int
+		wantCeiling time.Duration
+	}{
+		{"attempt 0", ReconnectConfig{BaseDelay: time.Second, MaxDelay: time.Minute}, 0, time.Second},
+		{"attempt 1", ReconnectConfig{BaseDelay: time.Second, MaxDelay: time.Minute}, 1, 2 * time.Second},
+		{"reaches max", ReconnectConfig{BaseDelay: time.Second, MaxDelay: time.Minute}, 6, time.Minute},
+		{"large", ReconnectConfig{BaseDelay: time.Second, MaxDelay: time.Hour}, 40, time.Hour},
+		{"huge", ReconnectConfig{BaseDelay: time.Second, MaxDelay: time.Hour}, math.MaxInt, time.Hour},
+		{"max duration", ReconnectConfig{BaseDelay: time.Nanosecond, MaxDelay: math.MaxInt64}, 62, 1 << 62},
+		{"max duration overflow", ReconnectConfig{BaseDelay: time.Nanosecond, MaxDelay: math.MaxInt64}, 63, math.MaxInt64},
+		{"defaults", ReconnectConfig{}, 100, time.Minute},
+		{"max below base", ReconnectConfig{BaseDelay: time.Minute, MaxDelay: time.Second}, 1, time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			base, max := tc.config.BaseDelay, tc.config.MaxDelay
+			if base <= 0 {
+				base = time.Second
+			}
+			if max <= 0 {
+				max = time.Minute
+			}
+
+			ceiling := tc.config.ceiling(tc.attempt)
+			if ceiling != tc.wantCeiling {
+				t.Errorf("ceiling(%d) = %s, want %s", tc.attempt, ceiling, tc.wantCeiling)
+			}
+			if ceiling > max || (ceiling < base && max >= base) {
+				t.Errorf("ceiling(%d) = %s, not within [%s, %s]", tc.attempt, ceiling, base, max)
+			}
+			for i := 0; i < 100; i++ {
+				if d := tc.config.backoff(tc.attempt); d < 0 || d > ceiling {
+					t.Fatalf("backoff(%d) = %s, not within [0, %s]", tc.attempt, d, ceiling)
+				}
+			}
+		})
+	}
+}
+
+func TestPingTimesOut(t *testing.T) {
+	db := openFakeDB(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		// A server that accepts the connection but hangs
+		time.Sleep(100 * time.Millisecond)
+		return []string{"1"}, [][]driver.Value{{int64(1)}}, nil
+	})
+
+	if err := ping(db, DatabaseConfig{Name: "hung", PingTimeout: 10 * time.Millisecond}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ping of a hung server = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := ping(db, DatabaseConfig{Name: "slow"}); err != nil {
+		t.Errorf("ping within the default timeout = %v, want nil", err)
+	}
+}
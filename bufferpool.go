@@ -0,0 +1,54 @@
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	innodbPagesFlushed = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_innodb_pages_flushed_total",
+			Help: "Number of requests to flush pages from the InnoDB buffer pool (Innodb_buffer_pool_pages_flushed).",
+		},
+		labelNames(),
+	)
+	innodbPagesWritten = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_innodb_pages_written_total",
+			Help: "Number of pages written by operations on InnoDB tables (Innodb_pages_written).",
+		},
+		labelNames(),
+	)
+	innodbPagesRead = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_innodb_pages_read_total",
+			Help: "Number of pages read from disk by operations on InnoDB tables (Innodb_pages_read).",
+		},
+		labelNames(),
+	)
+	innodbBufferPoolWaitFree = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_innodb_buffer_pool_wait_free_total",
+			Help: "Number of times InnoDB had to wait for pages to be flushed before reading or creating a page (Innodb_buffer_pool_wait_free).",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(innodbPagesFlushed)
+	mustRegisterVec(innodbPagesWritten)
+	mustRegisterVec(innodbPagesRead)
+	mustRegisterVec(innodbBufferPoolWaitFree)
+}
+
+// bufferPoolStatus maps the global status variables read by the buffer_pool
+// collector to their counters
+var bufferPoolStatus = map[string]metricVec{
+	"Innodb_buffer_pool_pages_flushed": innodbPagesFlushed,
+	"Innodb_pages_written":             innodbPagesWritten,
+	"Innodb_pages_read":                innodbPagesRead,
+	"Innodb_buffer_pool_wait_free":     innodbBufferPoolWaitFree,
+}
+
+func collectBufferPool(s *snapshot) {
+	queryStatusMetrics(s, "buffer_pool", bufferPoolStatus)
+}
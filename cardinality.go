@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var cardinalityLimited = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_collector_cardinality_limited",
+		Help: "Whether the last run of a collector dropped series above max_series_per_collector (1) or not (0).",
+	},
+	labelNames("collector"),
+)
+
+func init() {
+	mustRegisterVec(cardinalityLimited)
+}
+
+// seriesBudget caps the number of label sets a collector run exports per
+// metric. Collectors scan rows largest first where they can, so the series
+// that are kept are the top ones by value.
+type seriesBudget struct {
+	dbConfig  DatabaseConfig
+	collector string
+	used      int
+	dropped   int
+}
+
+func newSeriesBudget(dbConfig DatabaseConfig, collector string) *seriesBudget {
+	return &seriesBudget{dbConfig: dbConfig, collector: collector}
+}
+
+// allow reports whether one more label set can be exported
+func (b *seriesBudget) allow() bool {
+	if limit := b.dbConfig.MaxSeriesPerCollector; limit > 0 && b.used >= limit {
+		b.dropped++
+		return false
+	}
+	b.used++
+	return true
+}
+
+// done exports whether the run was limited, and warns when it was
+func (b *seriesBudget) done() {
+	limited := 0.0
+	if b.dropped > 0 {
+		limited = 1
+		log.Printf("database %s: WARN %s exceeded max_series_per_collector=%d, skipped %d label sets",
+			b.dbConfig.Name, b.collector, b.dbConfig.MaxSeriesPerCollector, b.dropped)
+	}
+	cardinalityLimited.WithLabelValues(b.dbConfig.labelValues(b.collector)...).Set(limited)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gaugeValue returns the current value of a gauge or counter
+func gaugeValue(t *testing.T, metric prometheus.Metric) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Counter != nil {
+		return m.GetCounter().GetValue()
+	}
+	return m.GetGauge().GetValue()
+}
+
+// captureLog returns what f logs
+func captureLog(t *testing.T, f func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(previous)
+	f()
+	return buf.String()
+}
+
+func TestSeriesBudgetCap(t *testing.T) {
+	dbConfig := DatabaseConfig{Name: "budget", MaxSeriesPerCollector: 3}
+	limited := cardinalityLimited.WithLabelValues(dbConfig.labelValues("tables")...)
+
+	b := newSeriesBudget(dbConfig, "tables")
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if b.allow() {
+			allowed++
+		} else if i < 3 {
+			t.Errorf("row %d refused below the cap", i)
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("allowed %d rows, want 3", allowed)
+	}
+
+	output := captureLog(t, b.done)
+	if n := strings.Count(output, "exceeded max_series_per_collector=3"); n != 1 {
+		t.Errorf("logged the cap %d times, want once: %q", n, output)
+	}
+	if !strings.Contains(output, "skipped 7 label sets") {
+		t.Errorf("log does not count the 7 refused rows: %q", output)
+	}
+	if v := gaugeValue(t, limited); v != 1 {
+		t.Errorf("mysql_collector_cardinality_limited = %v, want 1", v)
+	}
+
+	// A run under the cap clears the metric and logs nothing
+	b = newSeriesBudget(dbConfig, "tables")
+	b.allow()
+	if output := captureLog(t, b.done); output != "" {
+		t.Errorf("run under the cap logged %q", output)
+	}
+	if v := gaugeValue(t, limited); v != 0 {
+		t.Errorf("mysql_collector_cardinality_limited = %v after a run under the cap, want 0", v)
+	}
+}
+
+func TestSeriesBudgetUnlimited(t *testing.T) {
+	b := newSeriesBudget(DatabaseConfig{Name: "unlimited"}, "tables")
+	for i := 0; i < 1000; i++ {
+		if !b.allow() {
+			t.Fatalf("row %d refused without max_series_per_collector", i)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var tableCharsetInfo = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_table_charset_info",
+		Help: "Character set and collation of MySQL tables, value is always 1.",
+	},
+	labelNames("database", "table", "charset", "collation"),
+)
+
+func init() {
+	mustRegisterVec(tableCharsetInfo)
+}
+
+func collectCharset(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	// Views have no collation, the inner join and table_type filter leave them out
+	rows, err := db.Query(`
+		SELECT t.table_schema, t.table_name, c.character_set_name, t.table_collation
+		FROM information_schema.tables t
+		JOIN information_schema.collations c ON c.collation_name = t.table_collation
+		WHERE t.table_type = 'BASE TABLE'
+	`)
+	if err != nil {
+		log.Printf("database %s: Error executing table charset query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	budget := newSeriesBudget(dbConfig, "charset")
+	defer budget.done()
+
+	// Drop dropped or converted tables and those of newly excluded schemas
+	tableCharsetInfo.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+
+	// Tables rewritten to the same labels only spend the budget once
+	exported := make(map[[4]string]bool)
+	for rows.Next() {
+		var dbName, tableName, charset, collation string
+
+		if err := rows.Scan(&dbName, &tableName, &charset, &collation); err != nil {
+			log.Printf("database %s: Error scanning table charset row: %v", cloudName, err)
+			continue
+		}
+		if !dbConfig.schemaAllowed(dbName) {
+			continue
+		}
+
+		dbName, tableName = dbConfig.rewriteTable(dbName, tableName)
+		key := [4]string{dbName, tableName, charset, collation}
+		if exported[key] || !budget.allow() {
+			continue
+		}
+		exported[key] = true
+		tableCharsetInfo.WithLabelValues(dbConfig.labelValues(dbName, tableName, charset, collation)...).Set(1)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing table charset query: %v", cloudName, err)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	errantTransactions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_errant_transactions",
+			Help: "Number of GTIDs executed on the replica that are not present on the cluster's primary.",
+		},
+		labelNames(),
+	)
+	replicaBytesBehind = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_replica_bytes_behind",
+			Help: "Number of bytes of the primary's binary log the replica has not yet read.",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(errantTransactions)
+	mustRegisterVec(replicaBytesBehind)
+}
+
+// ClusterConfig groups configured databases into a primary and its replicas,
+// for collectors that need to compare several servers
+type ClusterConfig struct {
+	Name     string        `yaml:"name"`
+	Primary  string        `yaml:"primary"`
+	Replicas []string      `yaml:"replicas"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// validate checks that every member of the cluster is a configured database
+func (c ClusterConfig) validate(targets map[string]target) error {
+	for _, name := range append([]string{c.Primary}, c.Replicas...) {
+		if _, ok := targets[name]; !ok {
+			return fmt.Errorf("unknown database %q", name)
+		}
+	}
+	if targets[c.Primary].config.ReplicaOnly {
+		return fmt.Errorf("primary %q is marked replica_only", c.Primary)
+	}
+	return nil
+}
+
+// validClusterName matches the allowed values of the cluster label
+var validClusterName = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`)
+
+// validateClusterName checks that name is usable as a cluster label
+func validateClusterName(name string) error {
+	if !validClusterName.MatchString(name) {
+		return fmt.Errorf("cluster %q may only contain letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// assignClusters sets the cluster of the members of each clusters entry to
+// the entry's name, so the cross-server metrics carry the same cluster label
+// as the members' other metrics. A member may only belong to one cluster.
+func assignClusters(databases []DatabaseConfig, clusters []ClusterConfig) error {
+	for _, cluster := range clusters {
+		if err := validateClusterName(cluster.Name); err != nil {
+			return err
+		}
+		for _, name := range append([]string{cluster.Primary}, cluster.Replicas...) {
+			for i := range databases {
+				if databases[i].Name != name {
+					continue
+				}
+				if databases[i].Cluster == "" {
+					databases[i].Cluster = cluster.Name
+				} else if databases[i].Cluster != cluster.Name {
+					return fmt.Errorf("database %s has cluster %q but is a member of cluster %s", name, databases[i].Cluster, cluster.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// runCluster runs the cross-server collectors of a cluster, forever, on the
+// databases current at each run
+func runCluster(cluster ClusterConfig, targets *targetSet) {
+	interval := cluster.Interval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	for {
+		if !pauses.isPaused(cluster.Primary) {
+			collectCluster(cluster, targets.snapshot())
+		}
+		time.Sleep(interval)
+	}
+}
+
+// collectCluster runs every cross-server collector of the cluster once
+func collectCluster(cluster ClusterConfig, targets map[string]target) {
+	collectErrantTransactions(cluster, targets)
+	collectReplicaBytesBehind(cluster, targets)
+}
+
+// countGTIDs returns the number of transactions in a GTID set such as
+// "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:11,4F22...:7".
+func countGTIDs(set string) int64 {
+	var count int64
+	set = strings.Join(strings.Fields(set), "")
+	if set == "" {
+		return 0
+	}
+	for _, uuidSet := range strings.Split(set, ",") {
+		parts := strings.Split(uuidSet, ":")
+		// parts[0] is the source UUID (and, on 8.3+, parts[1] may be a tag)
+		for _, interval := range parts[1:] {
+			var start, end int64
+			if n, _ := fmt.Sscanf(interval, "%d-%d", &start, &end); n == 2 {
+				count += end - start + 1
+			} else if n == 1 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func collectErrantTransactions(cluster ClusterConfig, targets map[string]target) {
+	primary := targets[cluster.Primary]
+
+	for _, name := range cluster.Replicas {
+		if pauses.isPaused(name) {
+			continue
+		}
+		replica := targets[name]
+
+		// Read the replica first: anything it executed must already be on the
+		// primary by the time the primary is read, unless it is errant
+		var replicaExecuted, primaryExecuted string
+		if err := replica.db.QueryRow("SELECT @@GLOBAL.gtid_executed").Scan(&replicaExecuted); err != nil {
+			log.Printf("database %s: Error reading gtid_executed: %v", name, err)
+			continue
+		}
+		if err := primary.db.QueryRow("SELECT @@GLOBAL.gtid_executed").Scan(&primaryExecuted); err != nil {
+			log.Printf("database %s: Error reading gtid_executed: %v", cluster.Primary, err)
+			return
+		}
+
+		var errant string
+		if err := replica.db.QueryRow("SELECT GTID_SUBTRACT(?, ?)", replicaExecuted, primaryExecuted).Scan(&errant); err != nil {
+			log.Printf("database %s: Error computing errant GTIDs: %v", name, err)
+			continue
+		}
+
+		errantTransactions.WithLabelValues(replica.config.labelValues()...).Set(float64(countGTIDs(errant)))
+	}
+}
+
+// binlogFile is an entry of SHOW BINARY LOGS
+type binlogFile struct {
+	name string
+	size int64
+}
+
+// binlogBytesBehind returns the number of bytes between a replica's read
+// position and the primary's write position, where logs are the primary's
+// binary logs in order. When the files differ, the rest of the replica's
+// file and every file in between count as behind. It reports false when the
+// replica's file is no longer on the primary.
+func binlogBytesBehind(logs []binlogFile, replicaFile string, replicaPos int64, primaryFile string, primaryPos int64) (int64, bool) {
+	if replicaFile == primaryFile {
+		if primaryPos < replicaPos {
+			return 0, true
+		}
+		return primaryPos - replicaPos, true
+	}
+
+	var behind int64
+	found := false
+	for _, file := range logs {
+		switch {
+		case file.name == replicaFile:
+			found = true
+			if file.size > replicaPos {
+				behind += file.size - replicaPos
+			}
+		case file.name == primaryFile:
+			if !found {
+				return 0, false
+			}
+			return behind + primaryPos, true
+		case found:
+			behind += file.size
+		}
+	}
+	return 0, false
+}
+
+// queryFirstRow runs the first of queries the server understands and
+// returns its first row, or nil when there are no rows
+func queryFirstRow(db queryer, queries ...string) (map[string]string, error) {
+	rows, err := queryRowMapsFallback(db, queries...)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+// primaryBinlogs reads the primary's current binary log position and the
+// sizes of its binary logs
+func primaryBinlogs(db queryer) (file string, pos int64, logs []binlogFile, err error) {
+	// SHOW MASTER STATUS was replaced by SHOW BINARY LOG STATUS in MySQL 8.2
+	status, err := queryFirstRow(db, "SHOW BINARY LOG STATUS", "SHOW MASTER STATUS")
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if status == nil {
+		return "", 0, nil, errors.New("binary logging is disabled")
+	}
+	pos, _ = strconv.ParseInt(status["position"], 10, 64)
+
+	rows, err := queryRowMaps(db, "SHOW BINARY LOGS")
+	if err != nil {
+		return "", 0, nil, err
+	}
+	for _, row := range rows {
+		size, _ := strconv.ParseInt(row["file_size"], 10, 64)
+		logs = append(logs, binlogFile{name: row["log_name"], size: size})
+	}
+	return status["file"], pos, logs, nil
+}
+
+// primaryChannel returns the replication channel of a replica whose source
+// is the server with serverID, or nil. Multi-source replicas have one channel
+// per source, and only the one replicating from the cluster's primary can be
+// compared with its binary logs.
+func primaryChannel(channels []map[string]string, serverID string) map[string]string {
+	for _, channel := range channels {
+		if channel["source_server_id"] == serverID {
+			return channel
+		}
+	}
+	return nil
+}
+
+func collectReplicaBytesBehind(cluster ClusterConfig, targets map[string]target) {
+	primary := targets[cluster.Primary]
+
+	var serverID string
+	if err := primary.db.QueryRow("SELECT @@server_id").Scan(&serverID); err != nil {
+		log.Printf("database %s: Error reading server_id: %v", cluster.Primary, err)
+		return
+	}
+
+	for _, name := range cluster.Replicas {
+		if pauses.isPaused(name) {
+			continue
+		}
+		replica := targets[name]
+		labels := prometheus.Labels{"cloud_name": name}
+
+		// Read the replica first, so that the primary is never behind it
+		channels, err := queryReplicaStatus(replica.db)
+		if err != nil {
+			log.Printf("database %s: Error reading replica status: %v", name, err)
+			continue
+		}
+		if len(channels) == 0 {
+			logOnce("not-replica:"+cluster.Name+":"+name, "database %s: not a replica, skipping byte lag in cluster %s", name, cluster.Name)
+			replicaBytesBehind.DeletePartialMatch(labels)
+			continue
+		}
+		channel := primaryChannel(channels, serverID)
+		if channel == nil {
+			logOnce("no-primary-channel:"+cluster.Name+":"+name, "database %s: no replication channel from primary %s (server_id %s), skipping byte lag", name, cluster.Primary, serverID)
+			replicaBytesBehind.DeletePartialMatch(labels)
+			continue
+		}
+		replicaFile := channel["source_log_file"]
+		replicaPos, _ := strconv.ParseInt(channel["read_source_log_pos"], 10, 64)
+
+		primaryFile, primaryPos, logs, err := primaryBinlogs(primary.db)
+		if err != nil {
+			log.Printf("database %s: Error reading binary log status: %v", cluster.Primary, err)
+			return
+		}
+
+		behind, ok := binlogBytesBehind(logs, replicaFile, replicaPos, primaryFile, primaryPos)
+		if !ok {
+			// Purged from the primary, so the lag can no longer be counted;
+			// a stale value would hide that the replica fell that far behind
+			logOnce("purged-binlog:"+cluster.Name+":"+name+":"+replicaFile, "database %s: Binary log %s is not on primary %s, skipping byte lag", name, replicaFile, cluster.Primary)
+			replicaBytesBehind.DeletePartialMatch(labels)
+			continue
+		}
+		replicaBytesBehind.WithLabelValues(replica.config.labelValues()...).Set(float64(behind))
+	}
+}
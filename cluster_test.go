@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBinlogBytesBehind(t *testing.T) {
+	logs := []binlogFile{
+		{name: "binlog.000010", size: 1000},
+		{name: "binlog.000011", size: 2000},
+		{name: "binlog.000012", size: 3000},
+		{name: "binlog.000013", size: 500},
+	}
+	tests := []struct {
+		name        string
+		replicaFile string
+		replicaPos  int64
+		primaryFile string
+		primaryPos  int64
+		want        int64
+		ok          bool
+	}{
+		{"same file", "binlog.000013", 200, "binlog.000013", 500, 300, true},
+		{"replica ahead of primary", "binlog.000013", 600, "binlog.000013", 500, 0, true},
+		{"one rollover", "binlog.000012", 2500, "binlog.000013", 100, 500 + 100, true},
+		{"files in between", "binlog.000010", 400, "binlog.000013", 100, 600 + 2000 + 3000 + 100, true},
+		{"replica file purged", "binlog.000009", 400, "binlog.000013", 100, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := binlogBytesBehind(logs, tt.replicaFile, tt.replicaPos, tt.primaryFile, tt.primaryPos)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("binlogBytesBehind() = %d, %v, want %d, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCollectReplicaBytesBehind(t *testing.T) {
+	primary := openFakeDB(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch query {
+		case "SELECT @@server_id":
+			return []string{"@@server_id"}, [][]driver.Value{{"1"}}, nil
+		case "SHOW BINARY LOG STATUS":
+			return []string{"File", "Position"}, [][]driver.Value{{"binlog.000012", "100"}}, nil
+		case "SHOW BINARY LOGS":
+			return []string{"Log_name", "File_size"}, [][]driver.Value{{"binlog.000011", "2000"}, {"binlog.000012", "3000"}}, nil
+		}
+		return nil, nil, fmt.Errorf("unexpected query %q", query)
+	})
+	// The replica also replicates from server 7, listed first
+	replicaFile := "binlog.000011"
+	replica := openFakeDB(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if query != "SHOW REPLICA STATUS" {
+			return nil, nil, fmt.Errorf("unexpected query %q", query)
+		}
+		return []string{"Channel_Name", "Source_Server_Id", "Source_Log_File", "Read_Source_Log_Pos"}, [][]driver.Value{
+			{"other", "7", "other-bin.000001", "5"},
+			{"", "1", replicaFile, "1500"},
+		}, nil
+	})
+	cluster := ClusterConfig{Name: "bytes-behind", Primary: "bytes-primary", Replicas: []string{"bytes-replica"}}
+	targets := map[string]target{
+		"bytes-primary": {db: primary, config: DatabaseConfig{Name: "bytes-primary"}},
+		"bytes-replica": {db: replica, config: DatabaseConfig{Name: "bytes-replica"}},
+	}
+
+	collectReplicaBytesBehind(cluster, targets)
+	if got := collectedSeries(t, replicaBytesBehind, "bytes-replica"); got[""] != 500+100 {
+		t.Fatalf("mysql_replica_bytes_behind = %v, want 600 from the primary's channel", got)
+	}
+
+	// The replica's file was purged from the primary
+	replicaFile = "binlog.000009"
+	var output string
+	for i := 0; i < 2; i++ {
+		output += captureLog(t, func() { collectReplicaBytesBehind(cluster, targets) })
+	}
+	if got := collectedSeries(t, replicaBytesBehind, "bytes-replica"); len(got) != 0 {
+		t.Errorf("mysql_replica_bytes_behind = %v after the replica's file was purged, want no series", got)
+	}
+	if n := strings.Count(output, "is not on primary"); n != 1 {
+		t.Errorf("purged file logged %d times over two runs, want once:\n%s", n, output)
+	}
+}
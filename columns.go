@@ -0,0 +1,52 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var schemaMismatch = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_collector_schema_mismatch",
+		Help: "Whether the last query of a collector returned columns other than expected (1) or not (0).",
+	},
+	labelNames("collector"),
+)
+
+func init() {
+	mustRegisterVec(schemaMismatch)
+}
+
+// errColumnMismatch is returned by queries whose result does not have the
+// expected columns. The mismatch has already been logged and exported.
+var errColumnMismatch = errors.New("unexpected columns")
+
+// checkColumns reports whether the leading columns of rows are named as
+// expected, compared case-insensitively. Trailing extra columns are allowed,
+// as some servers append their own. On a mismatch the actual columns are
+// logged once and mysql_collector_schema_mismatch is set.
+func checkColumns(rows *sql.Rows, dbConfig DatabaseConfig, collector string, expected ...string) bool {
+	columns, err := rows.Columns()
+	if err != nil {
+		log.Printf("database %s: Error reading %s columns: %v", dbConfig.Name, collector, err)
+		return false
+	}
+
+	ok := len(columns) >= len(expected)
+	for i := 0; ok && i < len(expected); i++ {
+		ok = strings.EqualFold(columns[i], expected[i])
+	}
+
+	if ok {
+		schemaMismatch.WithLabelValues(dbConfig.labelValues(collector)...).Set(0)
+		return true
+	}
+	logOnce("columns:"+dbConfig.Name+":"+collector, "database %s: %s returned columns %v, expected %v; skipping collection",
+		dbConfig.Name, collector, columns, expected)
+	schemaMismatch.WithLabelValues(dbConfig.labelValues(collector)...).Set(1)
+	return false
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Default upper bounds of mysql_connection_age_seconds, from a second to a day
+var defaultConnectionAgeBuckets = []float64{1, 10, 60, 300, 1800, 3600, 21600, 86400}
+
+// connectionAgeCommands are the processlist commands whose Time is observed
+var connectionAgeCommands = map[string]bool{"Sleep": true, "Query": true}
+
+// connectionAgeCollector exports the distribution of the processlist Time of
+// the last processlist collection as a histogram. Unlike a regular
+// histogram it does not accumulate across collections, so it is rebuilt as
+// const metrics from the latest observations on each scrape.
+type connectionAgeCollector struct {
+	mu        sync.Mutex
+	databases map[string]connectionAges
+}
+
+type connectionAges struct {
+	config DatabaseConfig
+	// ages holds the observed Time values by command
+	ages map[string][]float64
+}
+
+var connectionAge = &connectionAgeCollector{databases: make(map[string]connectionAges)}
+
+var connectionAgeDesc = prometheus.NewDesc(
+	"mysql_connection_age_seconds",
+	"Distribution of the time processlist threads running Sleep or Query have been in their current state, as of the last processlist collection.",
+	labelNames("command"), nil,
+)
+
+func init() {
+	mustRegisterCollector(connectionAge)
+}
+
+// connectionAgeBuckets returns the histogram's upper bounds for the database
+func (c DatabaseConfig) connectionAgeBuckets() []float64 {
+	if len(c.ConnectionAgeBuckets) == 0 {
+		return defaultConnectionAgeBuckets
+	}
+	buckets := append([]float64(nil), c.ConnectionAgeBuckets...)
+	sort.Float64s(buckets)
+	return buckets
+}
+
+// processlistSeconds parses the processlist Time column, which the driver
+// returns as an integer, or as text for the text protocol and some
+// performance_schema sources. NULL (threads without a state) is skipped.
+func processlistSeconds(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case []byte:
+		seconds, err := strconv.ParseFloat(string(v), 64)
+		return seconds, err == nil
+	case string:
+		seconds, err := strconv.ParseFloat(v, 64)
+		return seconds, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// set replaces the observed ages of a database
+func (c *connectionAgeCollector) set(dbConfig DatabaseConfig, ages map[string][]float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.databases[dbConfig.Name] = connectionAges{config: dbConfig, ages: ages}
+}
+
+// remove stops exporting the ages of cloudName
+func (c *connectionAgeCollector) remove(cloudName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.databases, cloudName)
+}
+
+func (c *connectionAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- connectionAgeDesc
+}
+
+func (c *connectionAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, database := range c.databases {
+		bounds := database.config.connectionAgeBuckets()
+		for command, ages := range database.ages {
+			buckets := make(map[float64]uint64, len(bounds))
+			sum := 0.0
+			for _, age := range ages {
+				sum += age
+				for _, bound := range bounds {
+					if age <= bound {
+						buckets[bound]++
+					}
+				}
+			}
+			ch <- prometheus.MustNewConstHistogram(connectionAgeDesc, uint64(len(ages)), sum, buckets, database.config.labelValues(command)...)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// serverCounterVec exports counters kept by the server, such as status
+// variables, as counter metrics. Their values are read rather than counted
+// by the exporter, so like the global status collector the latest value of
+// each label set is kept here and turned into a const metric on each scrape.
+type serverCounterVec struct {
+	desc       *prometheus.Desc
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]serverCounter
+}
+
+type serverCounter struct {
+	labelValues []string
+	value       float64
+}
+
+func newServerCounterVec(opts prometheus.CounterOpts, labelNames []string) *serverCounterVec {
+	return &serverCounterVec{
+		desc:       prometheus.NewDesc(opts.Name, opts.Help, labelNames, nil),
+		labelNames: labelNames,
+		values:     make(map[string]serverCounter),
+	}
+}
+
+// set sets the counter of a label set to the value read from the server
+func (v *serverCounterVec) set(labelValues []string, value float64) {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("%s: %d label values for %d labels", v.desc, len(labelValues), len(v.labelNames)))
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[strings.Join(labelValues, "\xff")] = serverCounter{labelValues: labelValues, value: value}
+}
+
+// DeleteLabelValues deletes the counter of a label set, reporting whether
+// it existed
+func (v *serverCounterVec) DeleteLabelValues(labelValues ...string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	key := strings.Join(labelValues, "\xff")
+	_, ok := v.values[key]
+	delete(v.values, key)
+	return ok
+}
+
+// DeletePartialMatch deletes the counters of every label set matching
+// labels, returning how many were deleted
+func (v *serverCounterVec) DeletePartialMatch(labels prometheus.Labels) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	deleted := 0
+	for key, counter := range v.values {
+		if v.matches(counter.labelValues, labels) {
+			delete(v.values, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (v *serverCounterVec) matches(labelValues []string, labels prometheus.Labels) bool {
+	for name, value := range labels {
+		found := false
+		for i, labelName := range v.labelNames {
+			if labelName == name {
+				if labelValues[i] != value {
+					return false
+				}
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Describe sends no descriptors, making this an unchecked collector
+func (v *serverCounterVec) Describe(ch chan<- *prometheus.Desc) {}
+
+func (v *serverCounterVec) Collect(ch chan<- prometheus.Metric) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, counter := range v.values {
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.CounterValue, counter.value, counter.labelValues...)
+	}
+}
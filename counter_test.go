@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricType returns the exposed type of the metric family named name
+func metricType(t *testing.T, c prometheus.Collector, name string) dto.MetricType {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetType()
+		}
+	}
+	t.Fatalf("no %s metrics", name)
+	return 0
+}
+
+func TestServerCounterVec(t *testing.T) {
+	vec := newServerCounterVec(prometheus.CounterOpts{Name: "test_server_counter_total", Help: "Test."}, labelNames("table"))
+	a, b := DatabaseConfig{Name: "a"}, DatabaseConfig{Name: "b"}
+	vec.set(a.labelValues("t1"), 1)
+	vec.set(a.labelValues("t2"), 2)
+	vec.set(b.labelValues("t1"), 3)
+	vec.set(a.labelValues("t1"), 4)
+
+	if typ := metricType(t, vec, "test_server_counter_total"); typ != dto.MetricType_COUNTER {
+		t.Errorf("type = %v, want COUNTER", typ)
+	}
+	if got := collectedSeries(t, vec, "a", "table"); len(got) != 2 || got["t1"] != 4 || got["t2"] != 2 {
+		t.Errorf("series of a = %v, want t1 4 and t2 2", got)
+	}
+
+	if n := vec.DeletePartialMatch(prometheus.Labels{"cloud_name": "a"}); n != 2 {
+		t.Errorf("DeletePartialMatch deleted %d series, want 2", n)
+	}
+	if got := collectedSeries(t, vec, "a", "table"); len(got) != 0 {
+		t.Errorf("series of a after DeletePartialMatch = %v, want none", got)
+	}
+	if !vec.DeleteLabelValues(b.labelValues("t1")...) || vec.DeleteLabelValues(b.labelValues("t1")...) {
+		t.Error("DeleteLabelValues did not report the deleted series once")
+	}
+}
+
+func TestCollectBinlogExportsCounter(t *testing.T) {
+	db := openFakeDB(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch query {
+		case "SHOW GLOBAL STATUS":
+			return []string{"Variable_name", "Value"}, [][]driver.Value{{"Binlog_bytes_written", "12345"}}, nil
+		case "SHOW BINARY LOG STATUS":
+			return []string{"File", "Position"}, [][]driver.Value{{"binlog.000001", "157"}}, nil
+		}
+		return nil, nil, fmt.Errorf("unexpected query %q", query)
+	})
+	dbConfig := DatabaseConfig{Name: "binlog-counter"}
+	collectBinlog(newSnapshot(db, dbConfig))
+
+	if got := collectedSeries(t, binlogBytesWritten, dbConfig.Name); got[""] != 12345 {
+		t.Errorf("mysql_binlog_bytes_written_total = %v, want 12345", got)
+	}
+	if typ := metricType(t, binlogBytesWritten, "mysql_binlog_bytes_written_total"); typ != dto.MetricType_COUNTER {
+		t.Errorf("mysql_binlog_bytes_written_total type = %v, want COUNTER", typ)
+	}
+}
+
+func TestCollectProxySQLDeletesRemovedBackends(t *testing.T) {
+	backends := [][]driver.Value{
+		{"10", "db1", "3306", "ONLINE", "1", "2", "100", "0", "500", "250"},
+		{"10", "db2", "3306", "ONLINE", "1", "2", "200", "1", "900", "250"},
+	}
+	db := openFakeDB(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if query != "SELECT * FROM stats.stats_mysql_connection_pool" {
+			return nil, nil, fmt.Errorf("unexpected query %q", query)
+		}
+		return []string{"hostgroup", "srv_host", "srv_port", "status", "ConnUsed", "ConnFree", "ConnOK", "ConnERR", "Queries", "Latency_us"}, backends, nil
+	})
+	dbConfig := DatabaseConfig{Name: "proxysql-backends", Type: "proxysql"}
+
+	collectProxySQL(db, dbConfig)
+	if got := collectedSeries(t, proxysqlQueries, dbConfig.Name, "srv_host"); got["db1"] != 500 || got["db2"] != 900 {
+		t.Fatalf("proxysql_connection_pool_queries_total = %v, want db1 500 and db2 900", got)
+	}
+	if typ := metricType(t, proxysqlQueries, "proxysql_connection_pool_queries_total"); typ != dto.MetricType_COUNTER {
+		t.Errorf("proxysql_connection_pool_queries_total type = %v, want COUNTER", typ)
+	}
+
+	backends = backends[:1]
+	collectProxySQL(db, dbConfig)
+	for _, c := range []prometheus.Collector{proxysqlConnUsed, proxysqlQueries, proxysqlStatus} {
+		if got := collectedSeries(t, c, dbConfig.Name, "srv_host"); len(got) != 1 || got["db1"] == 0 {
+			t.Errorf("series after db2 left the pool = %v, want only db1", got)
+		}
+	}
+}
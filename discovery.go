@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SRVDiscoveryConfig collects from every host published in a DNS SRV record,
+// adding and removing databases as the record changes
+type SRVDiscoveryConfig struct {
+	// Service is the full SRV name, such as _mysql._tcp.db.example.com
+	Service string `yaml:"service"`
+	// RefreshInterval is how often the record is resolved. Defaults to 1m.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// Database is the settings of the discovered databases. Each is named
+	// after its host (with the port unless 3306) and connects to it with the
+	// credentials and parameters of the DSN.
+	Database DatabaseConfig `yaml:"database"`
+}
+
+func (c SRVDiscoveryConfig) refreshInterval() time.Duration {
+	if c.RefreshInterval <= 0 {
+		return time.Minute
+	}
+	return c.RefreshInterval
+}
+
+// validate checks the service and the database settings shared by the
+// discovered databases
+func (c SRVDiscoveryConfig) validate(environments []string) error {
+	if c.Service == "" {
+		return errors.New("service is required")
+	}
+	if _, err := mysql.ParseDSN(c.Database.DSN); err != nil {
+		return err
+	}
+	if len(c.Database.Hosts) > 0 {
+		return errors.New("hosts cannot be set for discovered databases")
+	}
+	return validateDatabase(c.Database, environments)
+}
+
+// resolve returns the databases of the hosts currently in the record
+func (c SRVDiscoveryConfig) resolve() ([]DatabaseConfig, error) {
+	_, records, err := net.LookupSRV("", "", c.Service)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := mysql.ParseDSN(c.Database.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	databases := make([]DatabaseConfig, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		port := strconv.Itoa(int(record.Port))
+
+		dbConfig := c.Database
+		dbConfig.Name = host
+		if port != "3306" {
+			dbConfig.Name += ":" + port
+		}
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(host, port)
+		dbConfig.DSN = cfg.FormatDSN()
+		databases = append(databases, dbConfig)
+	}
+	return databases, nil
+}
+
+// discoveredTarget is a database added by SRV discovery, collected until
+// stop is closed
+type discoveredTarget struct {
+	target
+	service string
+	stop    chan struct{}
+}
+
+// Databases added by all SRV discoveries, keyed by cloud_name
+var (
+	discoveredMu sync.Mutex
+	discovered   = make(map[string]*discoveredTarget)
+)
+
+// runSRVDiscovery resolves the record every refresh interval, forever,
+// starting collection from new hosts and stopping it for removed ones. A
+// failed lookup keeps the current databases.
+func runSRVDiscovery(c SRVDiscoveryConfig, static *targetSet) {
+	for {
+		databases, err := c.resolve()
+		if err != nil {
+			log.Printf("srv_discovery %s: Error resolving SRV record, keeping the current databases: %v", c.Service, err)
+		} else {
+			syncDiscovered(c.Service, databases, static.snapshot())
+		}
+		time.Sleep(c.refreshInterval())
+	}
+}
+
+// syncDiscovered makes the databases discovered from service match databases
+func syncDiscovered(service string, databases []DatabaseConfig, static map[string]target) {
+	discoveredMu.Lock()
+	defer discoveredMu.Unlock()
+
+	current := make(map[string]bool)
+	for _, dbConfig := range databases {
+		current[dbConfig.Name] = true
+		if _, ok := static[dbConfig.Name]; ok {
+			logOnce("srv-static:"+service+":"+dbConfig.Name, "srv_discovery %s: %s is also in databases, skipping", service, dbConfig.Name)
+			continue
+		}
+		if d, ok := discovered[dbConfig.Name]; ok {
+			if d.service != service {
+				logOnce("srv-duplicate:"+service+":"+dbConfig.Name, "srv_discovery %s: %s is already discovered by %s, skipping", service, dbConfig.Name, d.service)
+			}
+			continue
+		}
+
+		t, err := openTarget(dbConfig)
+		if err != nil {
+			log.Printf("srv_discovery %s: Error in database %s: %v", service, dbConfig.Name, err)
+			continue
+		}
+		d := &discoveredTarget{target: t, service: service, stop: make(chan struct{})}
+		discovered[dbConfig.Name] = d
+		log.Printf("srv_discovery %s: added database %s", service, dbConfig.Name)
+		go startCollectors(t.db, dbConfig, d.stop)
+	}
+
+	for name, d := range discovered {
+		if d.service != service || current[name] {
+			continue
+		}
+		delete(discovered, name)
+		close(d.stop)
+		removeTarget(d.target)
+		log.Printf("srv_discovery %s: removed database %s", service, name)
+	}
+}
+
+// removeTarget forgets a database whose collectors were stopped and deletes
+// its series. A collection still running when it is stopped may export a
+// last value, which stale_series_ttl evicts.
+func removeTarget(t target) {
+	pauses.remove(t.config.Name)
+	profiles.remove(t.config.Name)
+	series.forget(t.config.Name)
+	t.db.Close()
+	unregisterClientTLS(t.config)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// dumpOnce collects once from every database and cluster and writes all
+// metrics to w in the text exposition format, as /metrics would serve them
+func dumpOnce(w io.Writer, targets map[string]target, clusters []ClusterConfig) error {
+	collectAll(targets, clusters)
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+	encoder := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	eventSchedulerEnabled = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_event_scheduler_enabled",
+			Help: "Whether the event scheduler is running (@@event_scheduler is ON).",
+		},
+		labelNames(),
+	)
+	eventLastExecuted = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_event_last_executed_timestamp_seconds",
+			Help: "Unix timestamp of the last start of the scheduled event, only for events that have run.",
+		},
+		labelNames("database", "event"),
+	)
+	eventStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_event_status",
+			Help: "Whether the scheduled event is ENABLED (1) or DISABLED (0).",
+		},
+		labelNames("database", "event"),
+	)
+)
+
+func init() {
+	mustRegisterVec(eventSchedulerEnabled)
+	mustRegisterVec(eventLastExecuted)
+	mustRegisterVec(eventStatus)
+}
+
+// collectEvents exports the state of the event scheduler and of the scheduled
+// events, so maintenance jobs that silently stopped running can be detected
+func collectEvents(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	var scheduler string
+	if err := db.QueryRow("SELECT @@event_scheduler").Scan(&scheduler); err != nil {
+		log.Printf("database %s: Error reading event_scheduler: %v", cloudName, err)
+		return
+	}
+	enabled := 0.0
+	if scheduler == "ON" {
+		enabled = 1
+	}
+	eventSchedulerEnabled.WithLabelValues(dbConfig.labelValues()...).Set(enabled)
+
+	// LAST_EXECUTED is in the session time zone, which UNIX_TIMESTAMP
+	// converts from
+	rows, err := db.Query("SELECT event_schema, event_name, status, UNIX_TIMESTAMP(last_executed) FROM information_schema.events")
+	if err != nil {
+		log.Printf("database %s: Error executing events query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	// Drop dropped events
+	eventLastExecuted.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	eventStatus.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for rows.Next() {
+		var schema, name, status string
+		var lastExecuted sql.NullFloat64
+		if err := rows.Scan(&schema, &name, &status, &lastExecuted); err != nil {
+			log.Printf("database %s: Error scanning events row: %v", cloudName, err)
+			continue
+		}
+		if !dbConfig.schemaAllowed(schema) {
+			continue
+		}
+
+		labels := dbConfig.labelValues(schema, name)
+		// SLAVESIDE_DISABLED events do not run on this server either
+		value := 0.0
+		if status == "ENABLED" {
+			value = 1
+		}
+		eventStatus.WithLabelValues(labels...).Set(value)
+		if lastExecuted.Valid {
+			eventLastExecuted.WithLabelValues(labels...).Set(lastExecuted.Float64)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing events query: %v", cloudName, err)
+	}
+}
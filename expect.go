@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"gopkg.in/yaml.v2"
+)
+
+// expectedSeries is one entry of a --test.rule file: a metric that must be
+// exported with at least one series matching labels. An empty label value
+// only requires the label to be present.
+type expectedSeries struct {
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+func (e expectedSeries) String() string {
+	names := make([]string, 0, len(e.Labels))
+	for name := range e.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	matchers := make([]string, len(names))
+	for i, name := range names {
+		matchers[i] = fmt.Sprintf("%s=%q", name, e.Labels[name])
+	}
+	return e.Name + "{" + strings.Join(matchers, ",") + "}"
+}
+
+// matches reports whether the gathered metric has the expected labels
+func (e expectedSeries) matches(metric *dto.Metric) bool {
+	labels := make(map[string]string)
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	for name, value := range e.Labels {
+		actual, ok := labels[name]
+		if !ok || (value != "" && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkExpectations collects once and checks that every series listed in
+// filename is exported, printing the missing ones as a diff to stderr
+func checkExpectations(filename string, targets map[string]target, clusters []ClusterConfig) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var expected []expectedSeries
+	if err := yaml.UnmarshalStrict(data, &expected); err != nil {
+		return err
+	}
+
+	collectAll(targets, clusters)
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+
+	var missing []expectedSeries
+	for _, e := range expected {
+		found := false
+		for _, metric := range byName[e.Name].GetMetric() {
+			if e.matches(metric) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, e)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "--- %s\n+++ exported\n", filename)
+	for _, e := range missing {
+		fmt.Fprintf(os.Stderr, "-%s\n", e)
+	}
+	return fmt.Errorf("%d of %d expected series are missing", len(missing), len(expected))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var connectedHost = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_connected_host",
+		Help: "The host of the hosts list the latest connection was made to, value is always 1.",
+	},
+	labelNames("host"),
+)
+
+func init() {
+	mustRegisterVec(connectedHost)
+}
+
+// failoverConnector opens each new connection to the first host of the
+// list that accepts it, so the pool moves back to the preferred host once it
+// is reachable again
+type failoverConnector struct {
+	dbConfig   DatabaseConfig
+	hosts      []string
+	connectors []driver.Connector
+
+	mu      sync.Mutex
+	current string
+}
+
+func (c *failoverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var errs []error
+	for i, connector := range c.connectors {
+		conn, err := connector.Connect(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c.connected(c.hosts[i])
+		return conn, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (c *failoverConnector) Driver() driver.Driver {
+	return c.connectors[0].Driver()
+}
+
+// connected records the host a connection was made to
+func (c *failoverConnector) connected(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if host == c.current {
+		return
+	}
+	if c.current != "" {
+		log.Printf("database %s: connected to %s instead of %s", c.dbConfig.Name, host, c.current)
+		forgetIdentity(c.dbConfig.Name)
+	}
+	c.current = host
+	connectedHost.DeletePartialMatch(prometheus.Labels{"cloud_name": c.dbConfig.Name})
+	connectedHost.WithLabelValues(c.dbConfig.labelValues(host)...).Set(1)
+}
+
+// openDB opens the database at dsn, or with hosts set, at the first of the
+// hosts that accepts the connection, using dsn for everything but the address
+func openDB(dbConfig DatabaseConfig, dsn string) (*sql.DB, error) {
+	if len(dbConfig.Hosts) == 0 {
+		return sql.Open("mysql", dsn)
+	}
+
+	c := &failoverConnector{dbConfig: dbConfig, hosts: dbConfig.Hosts}
+	for _, host := range dbConfig.Hosts {
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "3306")
+		}
+		cfg.Net = "tcp"
+		cfg.Addr = host
+
+		connector, err := mysql.NewConnector(cfg)
+		if err != nil {
+			return nil, err
+		}
+		c.connectors = append(c.connectors, connector)
+	}
+	return sql.OpenDB(c), nil
+}
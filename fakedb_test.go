@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeQuery answers a query of a collector under test with its columns and
+// rows. Queries it does not expect return an error.
+type fakeQuery func(query string, args []driver.Value) (columns []string, rows [][]driver.Value, err error)
+
+// openFakeDB returns a database answering every query with answer
+func openFakeDB(t *testing.T, answer fakeQuery) *sql.DB {
+	t.Helper()
+	db := sql.OpenDB(fakeConnector{answer})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type fakeConnector struct{ answer fakeQuery }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fake driver: use openFakeDB")
+}
+
+type fakeConn struct{ answer fakeQuery }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake driver: prepared statements are not supported")
+}
+func (c fakeConn) Close() error { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake driver: transactions are not supported")
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	columns, rows, err := c.answer(strings.TrimSpace(query), values)
+	if err != nil {
+		return nil, err
+	}
+	// Like the MySQL driver, fail a query whose context expired meanwhile
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+// ExecContext accepts every statement, such as session settings
+func (c fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// collectedSeries returns the value of each series of c for cloudName, keyed
+// by the values of labels joined with dots
+func collectedSeries(t *testing.T, c prometheus.Collector, cloudName string, labels ...string) map[string]float64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	series := make(map[string]float64)
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+		values := make(map[string]string)
+		for _, label := range pb.GetLabel() {
+			values[label.GetName()] = label.GetValue()
+		}
+		if values["cloud_name"] != cloudName {
+			continue
+		}
+		key := make([]string, len(labels))
+		for i, label := range labels {
+			key[i] = values[label]
+		}
+		value := pb.GetGauge().GetValue()
+		if pb.Counter != nil {
+			value = pb.GetCounter().GetValue()
+		} else if pb.Untyped != nil {
+			value = pb.GetUntyped().GetValue()
+		}
+		series[strings.Join(key, ".")] = value
+	}
+	return series
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var heartbeatLag = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_heartbeat_lag_seconds",
+		Help: "Replication lag measured from the pt-heartbeat table, in seconds.",
+	},
+	labelNames("server_id"),
+)
+
+func init() {
+	mustRegisterVec(heartbeatLag)
+}
+
+// HeartbeatConfig configures lag collection from a pt-heartbeat table
+type HeartbeatConfig struct {
+	CollectorConfig `yaml:",inline"`
+	Table           string `yaml:"table"`
+	Column          string `yaml:"column"`
+	// Timezone is the IANA zone the heartbeat timestamps are written in
+	// (e.g. "UTC" when pt-heartbeat runs with --utc). When empty, the
+	// timestamps are compared against NOW() in the MySQL session time zone.
+	Timezone string `yaml:"timezone"`
+}
+
+func (c HeartbeatConfig) table() string {
+	if c.Table == "" {
+		return "percona.heartbeat"
+	}
+	return c.Table
+}
+
+func (c HeartbeatConfig) column() string {
+	if c.Column == "" {
+		return "ts"
+	}
+	return c.Column
+}
+
+// parseHeartbeatTime parses timestamps written by pt-heartbeat
+// ("2006-01-02T15:04:05.000000") as well as MySQL DATETIME strings.
+func parseHeartbeatTime(value string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04:05.999999", strings.Replace(value, "T", " ", 1), loc)
+}
+
+func collectHeartbeat(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+	cfg := dbConfig.Heartbeat
+
+	// Compare against the server's clock rather than ours to avoid exporter clock skew
+	loc := time.UTC
+	now := "NOW(6)"
+	if cfg.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			logOnce("heartbeat-tz:"+cloudName, "database %s: Invalid heartbeat timezone %q: %v", cloudName, cfg.Timezone, err)
+			return
+		}
+		now = "UTC_TIMESTAMP(6)"
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT server_id, CAST(%s AS CHAR), CAST(%s AS CHAR) FROM %s",
+		quoteIdentifier(cfg.column()), now, quoteIdentifier(cfg.table())))
+	if err != nil {
+		if isMissingObjectError(err) {
+			logOnce("heartbeat-missing:"+cloudName, "database %s: Heartbeat table %s does not exist, skipping", cloudName, cfg.table())
+			return
+		}
+		log.Printf("database %s: Error executing heartbeat query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var serverID string
+		var ts, current sql.NullString
+
+		if err := rows.Scan(&serverID, &ts, &current); err != nil {
+			log.Printf("database %s: Error scanning heartbeat row: %v", cloudName, err)
+			continue
+		}
+		if !ts.Valid || !current.Valid {
+			continue
+		}
+
+		written, err := parseHeartbeatTime(ts.String, loc)
+		if err != nil {
+			log.Printf("database %s: Error parsing heartbeat timestamp %q: %v", cloudName, ts.String, err)
+			continue
+		}
+		observed, err := parseHeartbeatTime(current.String, time.UTC)
+		if err != nil {
+			log.Printf("database %s: Error parsing server timestamp %q: %v", cloudName, current.String, err)
+			continue
+		}
+
+		heartbeatLag.WithLabelValues(dbConfig.labelValues(serverID)...).Set(observed.Sub(written).Seconds())
+	}
+}
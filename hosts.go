@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	connectionsByHost = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_connections_by_host",
+			Help: "Number of connections grouped by client host, for the hosts with the most connections.",
+		},
+		labelNames("client_host"),
+	)
+	activeConnectionsByHost = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_active_connections_by_host",
+			Help: "Number of non-sleeping connections grouped by client host, for the hosts with the most connections.",
+		},
+		labelNames("client_host"),
+	)
+)
+
+func init() {
+	mustRegisterVec(connectionsByHost)
+	mustRegisterVec(activeConnectionsByHost)
+}
+
+const defaultTopHosts = 20
+
+// clientHost strips the port from a processlist Host value such as
+// "10.0.0.1:53422", "[::1]:53422", "fe80::1:53422" or "localhost"
+func clientHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	// Unbracketed IPv6 address followed by the port
+	if i := strings.LastIndex(host, ":"); i > 0 && strings.Count(host, ":") > 1 && isDigits(host[i+1:]) {
+		return host[:i]
+	}
+	return host
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func collectConnectionsByHost(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	rows, err := db.Query("SELECT host, command FROM " + dbConfig.processlistTable())
+	if err != nil {
+		log.Printf("database %s: Error executing connections by host query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	total := make(map[string]int)
+	active := make(map[string]int)
+	for rows.Next() {
+		var host, command sql.NullString
+		if err := rows.Scan(&host, &command); err != nil {
+			log.Printf("database %s: Error scanning connections by host row: %v", cloudName, err)
+			continue
+		}
+
+		name := "UNKNOWN_HOST"
+		if host.Valid && host.String != "" {
+			name = clientHost(host.String)
+		}
+		total[name]++
+		if command.String != "Sleep" {
+			active[name]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing connections by host query: %v", cloudName, err)
+		return
+	}
+
+	hosts := make([]string, 0, len(total))
+	for host := range total {
+		hosts = append(hosts, host)
+	}
+	// Hosts with as many connections are ordered by name, so the same hosts
+	// make the top N from one collection to the next
+	sort.Slice(hosts, func(i, j int) bool {
+		if total[hosts[i]] != total[hosts[j]] {
+			return total[hosts[i]] > total[hosts[j]]
+		}
+		return hosts[i] < hosts[j]
+	})
+
+	topHosts := dbConfig.TopHosts
+	if topHosts <= 0 {
+		topHosts = defaultTopHosts
+	}
+	if len(hosts) > topHosts {
+		hosts = hosts[:topHosts]
+	}
+
+	// Drop the hosts that disconnected or fell out of the top N
+	connectionsByHost.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	activeConnectionsByHost.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for _, host := range hosts {
+		connectionsByHost.WithLabelValues(dbConfig.labelValues(host)...).Set(float64(total[host]))
+		activeConnectionsByHost.WithLabelValues(dbConfig.labelValues(host)...).Set(float64(active[host]))
+	}
+}
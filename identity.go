@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	serverID = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_server_id",
+			Help: "The server_id of the MySQL server currently behind the configured DSN.",
+		},
+		labelNames(),
+	)
+	hostnameInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_hostname_info",
+			Help: "The hostname of the MySQL server currently behind the configured DSN, value is always 1.",
+		},
+		labelNames("hostname"),
+	)
+	versionInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_version_info",
+			Help: "The version of the MySQL server currently behind the configured DSN, value is always 1.",
+		},
+		labelNames("version"),
+	)
+)
+
+func init() {
+	mustRegisterVec(serverID)
+	mustRegisterVec(hostnameInfo)
+	mustRegisterVec(versionInfo)
+}
+
+type serverIdentity struct {
+	serverID int64
+	hostname string
+	version  string
+}
+
+// Identities read from each database, keyed by cloud_name. An entry is
+// dropped when the exporter may have reconnected to a different server.
+var (
+	identitiesMu sync.Mutex
+	identities   = make(map[string]serverIdentity)
+)
+
+// forgetIdentity makes the next collection re-read the server identity
+func forgetIdentity(cloudName string) {
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+	delete(identities, cloudName)
+}
+
+func collectServerIdentity(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	identitiesMu.Lock()
+	_, cached := identities[cloudName]
+	identitiesMu.Unlock()
+	if cached {
+		return
+	}
+
+	var identity serverIdentity
+	if err := db.QueryRow("SELECT @@server_id, @@hostname, @@version").Scan(&identity.serverID, &identity.hostname, &identity.version); err != nil {
+		log.Printf("database %s: Error reading server identity: %v", cloudName, err)
+		return
+	}
+
+	identitiesMu.Lock()
+	identities[cloudName] = identity
+	identitiesMu.Unlock()
+
+	// A floating DSN may now point at a different server
+	hostnameInfo.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	hostnameInfo.WithLabelValues(dbConfig.labelValues(identity.hostname)...).Set(1)
+	versionInfo.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	versionInfo.WithLabelValues(dbConfig.labelValues(identity.version)...).Set(1)
+	serverID.WithLabelValues(dbConfig.labelValues()...).Set(float64(identity.serverID))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var innodbIndexSize = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_innodb_index_size_bytes",
+		Help: "Size of the InnoDB index from its persistent statistics (mysql.innodb_index_stats), in bytes.",
+	},
+	labelNames("database", "table", "index"),
+)
+
+func init() {
+	mustRegisterVec(innodbIndexSize)
+}
+
+// IndexSizesConfig configures the per-index sizes, used to find the indexes
+// that make up most of a table's mysql_index_size_bytes
+type IndexSizesConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// TopTables limits each database to the indexes of its largest tables.
+	// Defaults to 20.
+	TopTables int `yaml:"top_tables"`
+}
+
+func (c IndexSizesConfig) topTables() int {
+	if c.TopTables <= 0 {
+		return 20
+	}
+	return c.TopTables
+}
+
+// collectIndexSizes exports the size statistic of each index, which InnoDB
+// keeps in pages and refreshes along with the other persistent statistics.
+// Partitions are stored as separate tables and not matched here.
+func collectIndexSizes(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	rows, err := db.Query(`
+		SELECT s.database_name, s.table_name, s.index_name, s.stat_value * @@innodb_page_size
+		FROM mysql.innodb_index_stats s
+		JOIN information_schema.tables t
+			ON t.table_schema = s.database_name AND t.table_name = s.table_name
+		WHERE s.stat_name = 'size'
+		ORDER BY t.data_length + t.index_length DESC, s.database_name, s.table_name
+	`)
+	if err != nil {
+		if isAccessDeniedError(err) {
+			logOnce("index-sizes-denied:"+cloudName, "database %s: no SELECT privilege on mysql.innodb_index_stats, skipping index_sizes", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing index sizes query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	// Rows are ordered by table size across all databases, so the budget
+	// keeps the indexes of the largest tables
+	topTables := dbConfig.IndexSizes.topTables()
+	tables := make(map[string]map[string]bool)
+	sizes := make(map[[3]string]float64)
+	budget := newSeriesBudget(dbConfig, "index_sizes")
+	defer budget.done()
+
+	for rows.Next() {
+		var dbName, tableName, indexName string
+		var size float64
+
+		if err := rows.Scan(&dbName, &tableName, &indexName, &size); err != nil {
+			log.Printf("database %s: Error scanning index sizes row: %v", cloudName, err)
+			continue
+		}
+		if !dbConfig.schemaAllowed(dbName) {
+			continue
+		}
+		// Indexes of tables rewritten to the same labels are summed
+		dbName, tableName = dbConfig.rewriteTable(dbName, tableName)
+		key := [3]string{dbName, tableName, indexName}
+		if _, exported := sizes[key]; exported {
+			sizes[key] += size
+			continue
+		}
+		if tables[dbName] == nil {
+			tables[dbName] = make(map[string]bool)
+		}
+		if !tables[dbName][tableName] {
+			if len(tables[dbName]) >= topTables {
+				continue
+			}
+			tables[dbName][tableName] = true
+		}
+		if !budget.allow() {
+			continue
+		}
+
+		sizes[key] = size
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing index sizes query: %v", cloudName, err)
+		return
+	}
+
+	// Drop dropped indexes and tables no longer among the largest
+	innodbIndexSize.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for key, size := range sizes {
+		innodbIndexSize.WithLabelValues(dbConfig.labelValues(key[0], key[1], key[2])...).Set(size)
+	}
+}
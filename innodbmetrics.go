@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	mustRegisterCollector(innodbMetrics)
+}
+
+// InnodbMetricsConfig selects the information_schema.innodb_metrics counters
+// to export, as the table has hundreds of them
+type InnodbMetricsConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// Metrics are the counter names, such as lock_deadlocks
+	Metrics []string `yaml:"metrics"`
+	// EnableMonitors turns on the listed counters that are disabled with
+	// SET GLOBAL innodb_monitor_enable, which needs SYSTEM_VARIABLES_ADMIN
+	// (SUPER before 8.0). Otherwise disabled counters are skipped.
+	EnableMonitors bool `yaml:"enable_monitors"`
+}
+
+var validInnodbMetricName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// validate requires a list of counter names when enabled. The names are
+// inlined in innodb_monitor_enable, so only counter name characters are
+// allowed.
+func (c InnodbMetricsConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Metrics) == 0 {
+		return errors.New("innodb_metrics: metrics is required")
+	}
+	for _, name := range c.Metrics {
+		if !validInnodbMetricName.MatchString(name) {
+			return fmt.Errorf("innodb_metrics: invalid metric name %q", name)
+		}
+	}
+	return nil
+}
+
+// innodbMetricsCollector exports the selected innodb_metrics counters of
+// each database as mysql_innodb_metrics_<name>. Like the global status
+// collector, names are only known from the configuration and types from the
+// table, so the latest values are kept here and turned into const metrics on
+// each scrape.
+type innodbMetricsCollector struct {
+	mu        sync.Mutex
+	databases map[string]innodbMetricsValues
+}
+
+type innodbMetricsValues struct {
+	config  DatabaseConfig
+	metrics []innodbMetric
+}
+
+type innodbMetric struct {
+	name      string
+	valueType prometheus.ValueType
+	count     float64
+}
+
+var innodbMetrics = &innodbMetricsCollector{databases: make(map[string]innodbMetricsValues)}
+
+// set replaces the counters exported for a database
+func (c *innodbMetricsCollector) set(dbConfig DatabaseConfig, metrics []innodbMetric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.databases[dbConfig.Name] = innodbMetricsValues{config: dbConfig, metrics: metrics}
+}
+
+// remove stops exporting the counters of cloudName
+func (c *innodbMetricsCollector) remove(cloudName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.databases, cloudName)
+}
+
+// Describe sends no descriptors, making this an unchecked collector
+func (c *innodbMetricsCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *innodbMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, database := range c.databases {
+		for _, metric := range database.metrics {
+			desc := prometheus.NewDesc(
+				"mysql_innodb_metrics_"+metricNameSuffix(metric.name),
+				"InnoDB counter from information_schema.innodb_metrics.",
+				labelNames(), nil,
+			)
+			ch <- prometheus.MustNewConstMetric(desc, metric.valueType, metric.count, database.config.labelValues()...)
+		}
+	}
+}
+
+// innodbMetricType maps the type column of innodb_metrics to a metric type.
+// Only value counters, such as trx_rseg_history_len, go up and down; the
+// others only increase until innodb_monitor_reset or a restart.
+func innodbMetricType(typ string) prometheus.ValueType {
+	if strings.EqualFold(typ, "value") {
+		return prometheus.GaugeValue
+	}
+	return prometheus.CounterValue
+}
+
+func collectInnodbMetrics(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+	cfg := dbConfig.InnodbMetrics
+
+	placeholders := make([]string, len(cfg.Metrics))
+	args := make([]interface{}, len(cfg.Metrics))
+	for i, name := range cfg.Metrics {
+		placeholders[i] = "?"
+		args[i] = name
+	}
+	rows, err := db.Query(`
+		SELECT name, count, type, status
+		FROM information_schema.innodb_metrics
+		WHERE name IN (`+strings.Join(placeholders, ", ")+`)
+	`, args...)
+	if isMissingObjectError(err) {
+		logOnce("innodb-metrics-missing:"+cloudName, "database %s: information_schema.innodb_metrics not available, skipping innodb_metrics", cloudName)
+		return
+	}
+	if err != nil {
+		log.Printf("database %s: Error executing innodb_metrics query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	var disabled []string
+	var values []innodbMetric
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var metric innodbMetric
+		var typ, status string
+		if err := rows.Scan(&metric.name, &metric.count, &typ, &status); err != nil {
+			log.Printf("database %s: Error scanning innodb_metrics row: %v", cloudName, err)
+			return
+		}
+		seen[metric.name] = true
+		if !strings.EqualFold(status, "enabled") {
+			disabled = append(disabled, metric.name)
+			continue
+		}
+		metric.valueType = innodbMetricType(typ)
+		values = append(values, metric)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing innodb_metrics query: %v", cloudName, err)
+		return
+	}
+	innodbMetrics.set(dbConfig, values)
+
+	for _, name := range cfg.Metrics {
+		if !seen[name] {
+			logOnce("innodb-metrics-unknown:"+cloudName+":"+name, "database %s: innodb_metrics has no counter %s, skipping it", cloudName, name)
+		}
+	}
+	for _, name := range disabled {
+		if !cfg.EnableMonitors {
+			logOnce("innodb-metrics-disabled:"+cloudName+":"+name, "database %s: innodb_metrics counter %s is disabled, skipping it (enable it with innodb_monitor_enable or enable_monitors)", cloudName, name)
+			continue
+		}
+		// The counter starts from zero and is exported from the next run
+		if _, err := db.Exec("SET GLOBAL innodb_monitor_enable = '" + name + "'"); err != nil {
+			logOnce("innodb-metrics-enable:"+cloudName+":"+name, "database %s: Error enabling innodb_metrics counter %s, skipping it: %v", cloudName, name, err)
+			continue
+		}
+		log.Printf("database %s: enabled innodb_metrics counter %s", cloudName, name)
+	}
+}
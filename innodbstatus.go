@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+)
+
+// parseInnodbStatus splits the output of SHOW ENGINE INNODB STATUS into its
+// sections, keyed by title (such as "INSERT BUFFER AND ADAPTIVE HASH INDEX").
+// Each section is introduced by its title between two lines of dashes.
+func parseInnodbStatus(status string) map[string]string {
+	lines := strings.Split(status, "\n")
+	sections := make(map[string]string)
+	title := ""
+	var body []string
+	for i := 0; i < len(lines); i++ {
+		if isInnodbStatusRule(lines[i]) && i+2 < len(lines) && isInnodbStatusRule(lines[i+2]) {
+			if title != "" {
+				sections[title] = strings.Join(body, "\n")
+			}
+			title, body = strings.TrimSpace(lines[i+1]), nil
+			i += 2
+			continue
+		}
+		body = append(body, lines[i])
+	}
+	if title != "" {
+		sections[title] = strings.Join(body, "\n")
+	}
+	return sections
+}
+
+// isInnodbStatusRule reports whether line is a line of dashes around a
+// section title. The = lines around the status header are not rules.
+func isInnodbStatusRule(line string) bool {
+	line = strings.TrimSpace(line)
+	return len(line) >= 3 && strings.Trim(line, "-") == ""
+}
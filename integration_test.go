@@ -0,0 +1,130 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/testcontainers/testcontainers-go/modules/mariadb"
+	tcmysql "github.com/testcontainers/testcontainers-go/modules/mysql"
+)
+
+// The integration tests run every collector, optional ones included, against
+// real servers started with testcontainers, to catch SQL that only some
+// versions reject or answer with other columns. They need Docker:
+//
+//	go test -tags integration -run Integration ./...
+
+// integrationServer starts a server and returns its DSN
+type integrationServer struct {
+	name  string
+	start func(t *testing.T) string
+}
+
+var integrationServers = []integrationServer{
+	{"mysql-5.7", startMySQL("mysql:5.7.44")},
+	{"mysql-8.0", startMySQL("mysql:8.0.36")},
+	{"mariadb-10.11", startMariaDB("mariadb:10.11")},
+}
+
+// integrationMetrics must have series for every server
+var integrationMetrics = []string{
+	"mysql_version_info",
+	"mysql_processlist_count",
+	"mysql_processlist_commands",
+	"mysql_table_size_bytes",
+	"mysql_database_size_bytes",
+}
+
+func startMySQL(image string) func(t *testing.T) string {
+	return func(t *testing.T) string {
+		ctx := context.Background()
+		container, err := tcmysql.Run(ctx, image,
+			tcmysql.WithDatabase("app"),
+			tcmysql.WithUsername("root"),
+			tcmysql.WithPassword("secret"),
+		)
+		if err != nil {
+			t.Fatalf("starting %s: %v", image, err)
+		}
+		t.Cleanup(func() { container.Terminate(context.Background()) })
+		dsn, err := container.ConnectionString(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dsn
+	}
+}
+
+func startMariaDB(image string) func(t *testing.T) string {
+	return func(t *testing.T) string {
+		ctx := context.Background()
+		container, err := mariadb.Run(ctx, image,
+			mariadb.WithDatabase("app"),
+			mariadb.WithUsername("root"),
+			mariadb.WithPassword("secret"),
+		)
+		if err != nil {
+			t.Fatalf("starting %s: %v", image, err)
+		}
+		t.Cleanup(func() { container.Terminate(context.Background()) })
+		dsn, err := container.ConnectionString(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dsn
+	}
+}
+
+func TestIntegrationCollectors(t *testing.T) {
+	for _, server := range integrationServers {
+		t.Run(server.name, func(t *testing.T) {
+			dbConfig := DatabaseConfig{Name: server.name, DSN: server.start(t)}
+			target, err := openTarget(dbConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { removeTarget(target) })
+			if _, err := target.db.Exec("CREATE TABLE app.orders (id INT PRIMARY KEY, note VARCHAR(64)) CHARACTER SET utf8mb4"); err != nil {
+				t.Fatal(err)
+			}
+			profiles.set(dbConfig.Name, profileVerbose)
+
+			// Collectors log the queries they fail to run or scan and keep going
+			output := captureLog(t, func() { collectOnce(target.db, dbConfig) })
+			for _, line := range strings.Split(output, "\n") {
+				if strings.Contains(line, "Error") {
+					t.Errorf("collector failed: %s", line)
+				}
+			}
+
+			// A pedantic registry rejects inconsistent label sets and types
+			registry := prometheus.NewPedanticRegistry()
+			for _, c := range collectors {
+				registry.MustRegister(c)
+			}
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("gathering metrics: %v", err)
+			}
+			seen := make(map[string]bool)
+			for _, family := range families {
+				for _, m := range family.GetMetric() {
+					for _, label := range m.GetLabel() {
+						if label.GetName() == "cloud_name" && label.GetValue() == dbConfig.Name {
+							seen[family.GetName()] = true
+						}
+					}
+				}
+			}
+			for _, name := range integrationMetrics {
+				if !seen[name] {
+					t.Errorf("%s has no series", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Default interval between keep-alive pings, below the idle timeout of most
+// firewalls and NAT gateways (often 5 minutes or more)
+const defaultKeepAliveInterval = 4 * time.Minute
+
+// KeepAliveConfig pings the database between collections, so that a
+// firewall does not silently drop the pooled connection while the slow tier
+// waits for its next run. The health check already pings every minute, so
+// this only matters when the connection must be used more often than that,
+// such as with a conn_max_idle_time under two minutes.
+type KeepAliveConfig struct {
+	// Enabled defaults to false
+	Enabled bool `yaml:"enabled"`
+	// Interval defaults to 4m, or to half of conn_max_idle_time when that
+	// is shorter
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (c KeepAliveConfig) enabled() bool {
+	return c.Enabled
+}
+
+// keepAliveInterval returns the interval between keep-alive pings. With
+// conn_max_idle_time, the pinged connection must be reused before the pool
+// closes it for being idle.
+func (c DatabaseConfig) keepAliveInterval() time.Duration {
+	if c.KeepAlive.Interval > 0 {
+		return c.KeepAlive.Interval
+	}
+	if c.ConnMaxIdleTime > 0 && c.ConnMaxIdleTime/2 < defaultKeepAliveInterval {
+		return c.ConnMaxIdleTime / 2
+	}
+	return defaultKeepAliveInterval
+}
+
+// validateKeepAlive rejects a keep-alive interval that lets the pool close
+// the connection before each ping, which would reconnect instead of keeping
+// the connection warm
+func validateKeepAlive(dbConfig DatabaseConfig) error {
+	if dbConfig.ConnMaxIdleTime < 0 {
+		return errors.New("conn_max_idle_time must not be negative")
+	}
+	if !dbConfig.KeepAlive.enabled() || dbConfig.ConnMaxIdleTime == 0 {
+		return nil
+	}
+	if interval := dbConfig.keepAliveInterval(); interval >= dbConfig.ConnMaxIdleTime {
+		return fmt.Errorf("keep_alive: interval %s must be shorter than conn_max_idle_time %s", interval, dbConfig.ConnMaxIdleTime)
+	}
+	return nil
+}
+
+// keepAlive runs the ping query, bounded by ping_timeout, every keep-alive
+// interval until done is closed, independently of the collector tiers. The
+// ping reuses an idle pooled connection, and one the server or a firewall
+// closed is replaced by the driver during the ping rather than failing the
+// next collection.
+// Other idle connections are left to conn_max_idle_time. While the database
+// is unreachable, reconnecting is left to the health check.
+func keepAlive(db *sql.DB, dbConfig DatabaseConfig, done <-chan struct{}) {
+	for sleep(dbConfig.keepAliveInterval(), done) {
+		if pauses.isPaused(dbConfig.Name) || breakers.isSuspended(dbConfig.Name) {
+			continue
+		}
+		if err := ping(db, dbConfig); err != nil {
+			log.Printf("database %s: Error running keep-alive ping: %v", dbConfig.Name, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	innodbRowLockWaits = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_innodb_row_lock_waits_total",
+			Help: "Number of times operations on InnoDB tables had to wait for a row lock (Innodb_row_lock_waits).",
+		},
+		labelNames(),
+	)
+	innodbRowLockCurrentWaits = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_innodb_row_lock_current_waits",
+			Help: "Number of row locks currently being waited for by operations on InnoDB tables (Innodb_row_lock_current_waits).",
+		},
+		labelNames(),
+	)
+	innodbRowLockTime = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_innodb_row_lock_time_ms_total",
+			Help: "Total time spent waiting for InnoDB row locks, in milliseconds (Innodb_row_lock_time).",
+		},
+		labelNames(),
+	)
+	rollbacks = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_rollback_total",
+			Help: "Number of ROLLBACK statements executed (Com_rollback).",
+		},
+		labelNames(),
+	)
+	metadataLockWaitsCurrent = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_metadata_lock_waits_current",
+			Help: "Number of pending metadata lock requests on the object, for the objects with the most waits.",
+		},
+		labelNames("object_schema", "object_name"),
+	)
+	metadataLockWaits = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_metadata_lock_waits",
+			Help: "Number of pending metadata lock requests on all objects.",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(innodbRowLockWaits)
+	mustRegisterVec(innodbRowLockCurrentWaits)
+	mustRegisterVec(innodbRowLockTime)
+	mustRegisterVec(rollbacks)
+	mustRegisterVec(metadataLockWaitsCurrent)
+	mustRegisterVec(metadataLockWaits)
+}
+
+// lockStatus maps the global status variables read by the locks collector
+// to their gauges and counters
+var lockStatus = map[string]metricVec{
+	"Innodb_row_lock_waits":         innodbRowLockWaits,
+	"Innodb_row_lock_current_waits": innodbRowLockCurrentWaits,
+	"Innodb_row_lock_time":          innodbRowLockTime,
+	"Com_rollback":                  rollbacks,
+}
+
+func collectLocks(s *snapshot) {
+	queryStatusMetrics(s, "locks", lockStatus)
+}
+
+// Metadata lock waits are only exported per object for the objects with the
+// most waits
+const topMetadataLockObjects = 20
+
+// collectMetadataLocks counts the pending requests in
+// performance_schema.metadata_locks, which is only filled while the
+// wait/lock/metadata/sql/mdl instrument is enabled (the default since 8.0)
+func collectMetadataLocks(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	var enabled string
+	err := db.QueryRow("SELECT enabled FROM performance_schema.setup_instruments WHERE name = 'wait/lock/metadata/sql/mdl'").Scan(&enabled)
+	if err == sql.ErrNoRows || isMissingObjectError(err) {
+		logOnce("metadata-locks-missing:"+cloudName, "database %s: performance_schema metadata lock instrumentation not available, skipping metadata_locks", cloudName)
+		return
+	}
+	if err != nil {
+		log.Printf("database %s: Error reading metadata lock instrumentation: %v", cloudName, err)
+		return
+	}
+	if enabled != "YES" {
+		logOnce("metadata-locks-disabled:"+cloudName, "database %s: instrument wait/lock/metadata/sql/mdl is disabled, skipping metadata_locks", cloudName)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT COALESCE(object_schema, ''), COALESCE(object_name, ''), COUNT(*) AS waits
+		FROM performance_schema.metadata_locks
+		WHERE lock_status = 'PENDING'
+		GROUP BY object_schema, object_name
+		ORDER BY waits DESC
+	`)
+	if err != nil {
+		log.Printf("database %s: Error executing metadata locks query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	metadataLockWaitsCurrent.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	total, objects := 0, 0
+	for rows.Next() {
+		var schema, name string
+		var waits int
+		if err := rows.Scan(&schema, &name, &waits); err != nil {
+			log.Printf("database %s: Error scanning metadata locks row: %v", cloudName, err)
+			return
+		}
+		total += waits
+		if objects < topMetadataLockObjects {
+			metadataLockWaitsCurrent.WithLabelValues(dbConfig.labelValues(schema, name)...).Set(float64(waits))
+			objects++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing metadata locks query: %v", cloudName, err)
+		return
+	}
+	metadataLockWaits.WithLabelValues(dbConfig.labelValues()...).Set(float64(total))
+}
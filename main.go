@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"io/ioutil"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gopkg.in/yaml.v2"
@@ -19,44 +27,148 @@ var (
 		prometheus.GaugeOpts{
 			Name: "mysql_table_size_bytes",
 			Help: "Size of tables in MySQL, in bytes.",
-		}, []string{"cloud_name", "database", "table", "origin_prometheus"},
+		}, labelNames("database", "table"),
 	)
 	indexSize = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "mysql_index_size_bytes",
 			Help: "Size of indexes in MySQL, in bytes.",
 		},
-		[]string{"cloud_name", "database", "table", "origin_prometheus"},
+		labelNames("database", "table"),
 	)
 	tableRows = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "mysql_table_rows",
 			Help: "Number of rows in MySQL tables.",
 		},
-		[]string{"cloud_name", "database", "table", "origin_prometheus"},
+		labelNames("database", "table"),
+	)
+	tablesByEngine = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_tables_by_engine",
+			Help: "Number of tables in MySQL, grouped by database and storage engine.",
+		},
+		labelNames("database", "engine"),
+	)
+	databaseSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_database_size_bytes",
+			Help: "Total size of tables and indexes in each MySQL database, in bytes.",
+		},
+		labelNames("database"),
 	)
 	processListCount = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "mysql_processlist_count",
 			Help: "Number of processes in the processlist, grouped by user and database.",
 		},
-		[]string{"cloud_name", "user", "db", "origin_prometheus"},
+		labelNames("user", "db"),
 	)
 	connCount = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "mysql_conn_count",
 			Help: "Number of connections grouped by user and database.",
 		},
-		[]string{"cloud_name", "user", "db", "origin_prometheus"},
+		labelNames("user", "db"),
+	)
+	databaseConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_database_connections_current",
+			Help: "Number of connections per default database, including sleeping ones.",
+		},
+		labelNames("database"),
+	)
+	tableAvgRowLength = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_table_avg_row_length_bytes",
+			Help: "Average row length of MySQL tables, in bytes.",
+		},
+		labelNames("database", "table"),
+	)
+	tableBloatRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_table_bloat_ratio",
+			Help: "Estimated bloat of MySQL tables: data size divided by rows times average row length.",
+		},
+		labelNames("database", "table"),
+	)
+	tablesOtherSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_tables_other_size_bytes",
+			Help: "Total size of tables and indexes of the tables beyond top_tables_by_size in each MySQL database, in bytes.",
+		},
+		labelNames("database"),
+	)
+	schemaTableCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_schema_table_count",
+			Help: "Number of tables and views in each MySQL database.",
+		},
+		labelNames("database"),
+	)
+	schemaTableCountOverThreshold = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_schema_table_count_over_threshold",
+			Help: "Whether the database has more tables than schema_table_threshold (1) or not (0).",
+		},
+		labelNames("database"),
+	)
+	processListSleepingCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_processlist_sleeping_count",
+			Help: "Number of sleeping processes in the processlist, exported when exclude_sleeping is enabled.",
+		},
+		labelNames("user", "db"),
+	)
+	connSleepingCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_conn_sleeping_count",
+			Help: "Number of sleeping connections grouped by user and database, exported when exclude_sleeping is enabled.",
+		},
+		labelNames("user", "db"),
+	)
+	processListCountRaw = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_processlist_count_raw",
+			Help: "Unsmoothed number of processes in the processlist, exported when smoothing is enabled.",
+		},
+		labelNames("user", "db"),
+	)
+	connCountRaw = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_conn_count_raw",
+			Help: "Unsmoothed number of connections, exported when smoothing is enabled.",
+		},
+		labelNames("user", "db"),
+	)
+	processListCommands = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_processlist_commands",
+			Help: "Number of processes in the processlist, grouped by command (Query, Sleep, Binlog Dump, ...).",
+		},
+		labelNames("command"),
 	)
 )
 
 func init() {
-	prometheus.MustRegister(tableSize)
-	prometheus.MustRegister(indexSize)
-	prometheus.MustRegister(tableRows)
-	prometheus.MustRegister(processListCount)
-	prometheus.MustRegister(connCount)
+	mustRegisterVec(tableSize)
+	mustRegisterVec(indexSize)
+	mustRegisterVec(tableRows)
+	mustRegisterVec(tablesByEngine)
+	mustRegisterVec(databaseSize)
+	mustRegisterVec(tableAvgRowLength)
+	mustRegisterVec(tableBloatRatio)
+	mustRegisterVec(tablesOtherSize)
+	mustRegisterVec(schemaTableCount)
+	mustRegisterVec(schemaTableCountOverThreshold)
+	mustRegisterVec(processListCount)
+	mustRegisterVec(connCount)
+	mustRegisterVec(databaseConnections)
+	mustRegisterVec(processListSleepingCount)
+	mustRegisterVec(connSleepingCount)
+	mustRegisterVec(processListCountRaw)
+	mustRegisterVec(connCountRaw)
+	mustRegisterVec(processListCommands)
 
 	// 移除默认的 Prometheus 指标
 	prometheus.Unregister(prometheus.NewGoCollector())        // 去除Go的运行时指标
@@ -66,40 +178,417 @@ func init() {
 
 // Config structure for YAML file
 type Config struct {
-	Databases []struct {
-		Name             string `yaml:"name"`
-		DSN              string `yaml:"dsn"`
-		OriginPrometheus string `yaml:"origin_prometheus"`
-	} `yaml:"databases"`
+	BasicAuth BasicAuthConfig `yaml:"basic_auth"`
+	// Defaults are merged into every database entry that does not set them
+	Defaults DatabaseConfig `yaml:"defaults"`
+	// Environments, when set, is the list of allowed database environments
+	Environments []string         `yaml:"environments"`
+	Databases    []DatabaseConfig `yaml:"databases"`
+	Clusters     []ClusterConfig  `yaml:"clusters"`
+	// StaleSeriesTTL evicts the series of a database that has not been
+	// collected for this long, including while it is paused or suspended.
+	// The health check and pause series are kept. Disabled when zero.
+	StaleSeriesTTL time.Duration `yaml:"stale_series_ttl"`
+	// MetricNamespace, when set, is prepended to every metric name
+	MetricNamespace string `yaml:"metric_namespace"`
+	// WebTLS serves the HTTP endpoints over HTTPS
+	WebTLS WebTLSConfig `yaml:"web_tls"`
+	// SRVDiscovery adds and removes databases as DNS SRV records change
+	SRVDiscovery []SRVDiscoveryConfig `yaml:"srv_discovery"`
+	// StatsD also sends the metrics to a StatsD server
+	StatsD StatsDConfig `yaml:"statsd"`
+}
+
+// DatabaseConfig describes a single MySQL instance to collect from
+type DatabaseConfig struct {
+	Name             string `yaml:"name"`
+	DSN              string `yaml:"dsn"`
+	OriginPrometheus string `yaml:"origin_prometheus"`
+	// Hosts, when set, replaces the address of the DSN: each connection is
+	// made to the first host that accepts it
+	Hosts []string `yaml:"hosts"`
+	// Environment is exported as the environment label on all metrics
+	Environment string `yaml:"environment"`
+	// Cluster is the logical cluster or shard group the server belongs to,
+	// exported as the cluster label on all metrics. Members of a clusters
+	// entry default to its name.
+	Cluster string `yaml:"cluster"`
+	// Provider is "generic" (the default), "azure" for Azure Database for
+	// MySQL or "gcp" for Cloud SQL for MySQL
+	Provider string `yaml:"provider"`
+	// Type is "mysql" (the default), "proxysql" for a ProxySQL admin interface
+	// or "vitess" for a Vitess VTGate
+	Type string `yaml:"type"`
+	// ProxySQL overrides the collection interval when Type is "proxysql"
+	ProxySQL CollectorConfig `yaml:"proxysql"`
+	// Vitess overrides the collection interval when Type is "vitess"
+	Vitess CollectorConfig `yaml:"vitess"`
+
+	// IncludeDatabases, when set, limits per-schema collection to these
+	// schemas. Schemas in ExcludeDatabases are always skipped.
+	IncludeDatabases []string `yaml:"include_databases"`
+	ExcludeDatabases []string `yaml:"exclude_databases"`
+	// ExcludeSleeping counts Sleep threads separately from the processlist and
+	// connection count metrics
+	ExcludeSleeping bool `yaml:"exclude_sleeping"`
+	// ProcesslistSource is "processlist" (the default) or "performance_schema",
+	// which reads performance_schema.threads without the processlist mutex
+	ProcesslistSource string            `yaml:"processlist_source"`
+	Processlist       ProcesslistConfig `yaml:"processlist"`
+	// ConnectionAgeBuckets are the upper bounds of mysql_connection_age_seconds,
+	// in seconds
+	ConnectionAgeBuckets []float64 `yaml:"connection_age_buckets"`
+	// SchemaTableThreshold is the number of tables above which a database
+	// is flagged by mysql_schema_table_count_over_threshold. Defaults to 10000.
+	SchemaTableThreshold int `yaml:"schema_table_threshold"`
+	// TopTablesBySize limits the per-table metrics to the largest tables of
+	// each database, summing the rest into mysql_tables_other_size_bytes.
+	// All tables are exported when zero.
+	TopTablesBySize int `yaml:"top_tables_by_size"`
+	// MaxSeriesPerCollector caps the label sets each collector run exports
+	// per metric, as a backstop against runaway schemas. Unlimited when zero.
+	MaxSeriesPerCollector int `yaml:"max_series_per_collector"`
+	// PaginateBySchema scans the table sizes with one query per schema
+	// instead of a single query over information_schema.tables
+	PaginateBySchema bool `yaml:"paginate_by_schema"`
+	// TopHosts limits mysql_connections_by_host to the hosts with the most
+	// connections. Defaults to 20.
+	TopHosts int `yaml:"top_hosts"`
+	// UseCachedStats keeps the table size scan from triggering InnoDB
+	// statistics recalculation. Defaults to true.
+	UseCachedStats *bool `yaml:"use_cached_stats"`
+	// CollectTableRows, CollectDataLength and CollectIndexLength select which
+	// per-table size columns the table scan reads. All default to true.
+	CollectTableRows   *bool `yaml:"collect_table_rows"`
+	CollectDataLength  *bool `yaml:"collect_data_length"`
+	CollectIndexLength *bool `yaml:"collect_index_length"`
+	// CollectAllGlobalStatus exports every numeric SHOW GLOBAL STATUS
+	// variable as mysql_global_status_<name>
+	CollectAllGlobalStatus bool `yaml:"collect_all_global_status"`
+	// GlobalStatusRates exports the per-second change of each SHOW GLOBAL
+	// STATUS counter as mysql_global_status_<name>_per_second, for consumers
+	// that cannot use rate()
+	GlobalStatusRates bool `yaml:"global_status_rates"`
+	// ConsistentSnapshot runs the metadata collectors of each tier run in a
+	// single START TRANSACTION WITH CONSISTENT SNAPSHOT transaction
+	ConsistentSnapshot bool `yaml:"consistent_snapshot"`
+	// BatchQueries reads the global status and variables in a single
+	// performance_schema query shared by the collectors of a tier, for
+	// targets where round trips dominate the collection time
+	BatchQueries bool `yaml:"batch_queries"`
+	// ReplicaOnly marks a replica that is reachable without its primary and
+	// skips the collectors that need primary-only privileges
+	ReplicaOnly bool `yaml:"replica_only"`
+	// Tiers sets how often each collector tier runs, and CollectorTiers
+	// moves collectors (by name) to a tier other than their default
+	Tiers          TierConfig        `yaml:"tiers"`
+	CollectorTiers map[string]string `yaml:"collector_tiers"`
+	// Timeouts bounds the queries of one run of a collector (by name),
+	// defaulting to the collector's interval
+	Timeouts map[string]time.Duration `yaml:"timeouts"`
+	// DisableCollectors turns off collectors (by name) that run by default
+	DisableCollectors []string `yaml:"disable_collectors"`
+	// Smoothing is keyed by collector name ("conn_count", "processlist")
+	Smoothing      map[string]SmoothingConfig `yaml:"smoothing"`
+	CircuitBreaker CircuitBreakerConfig       `yaml:"circuit_breaker"`
+	Reconnect      ReconnectConfig            `yaml:"reconnect"`
+	TLS            TLSConfig                  `yaml:"tls"`
+	// ConnMaxIdleTime closes pooled connections idle for longer, unlimited
+	// by default, and KeepAlive pings the database between collections
+	ConnMaxIdleTime time.Duration   `yaml:"conn_max_idle_time"`
+	KeepAlive       KeepAliveConfig `yaml:"keep_alive"`
+	// SlowLogFile is the slow query log of the server, tailed when set
+	SlowLogFile string `yaml:"slow_log_file"`
+	// PingQuery is run by the health check to tell whether the database is
+	// up, default "SELECT 1", and fails after PingTimeout, default 10s
+	PingQuery   string        `yaml:"ping_query"`
+	PingTimeout time.Duration `yaml:"ping_timeout"`
+
+	// LabelRewrites normalize database and table labels before export, in
+	// order. Tables rewritten to the same labels are exported as one.
+	LabelRewrites []LabelRewriteConfig `yaml:"label_rewrites"`
+
+	// Optional collectors
+	Heartbeat   HeartbeatConfig  `yaml:"heartbeat"`
+	Charset     CollectorConfig  `yaml:"charset"`
+	ForeignKeys CollectorConfig  `yaml:"foreign_keys"`
+	Partitions  PartitionsConfig `yaml:"partitions"`
+	Tablespaces CollectorConfig  `yaml:"tablespaces"`
+	// StoredPrograms counts triggers, routines and events per schema
+	StoredPrograms CollectorConfig `yaml:"stored_programs"`
+	Accounts       AccountsConfig  `yaml:"accounts"`
+	ThreadCPU      ThreadCPUConfig `yaml:"thread_cpu"`
+	// SlowStatements counts the statement digests slower than a threshold
+	SlowStatements SlowStatementsConfig `yaml:"slow_statements"`
+	TableIO        TableIOConfig        `yaml:"table_io"`
+	// IndexSizes exports the size of every index of the largest tables
+	IndexSizes IndexSizesConfig `yaml:"index_sizes"`
+	// InnodbMetrics exports the listed information_schema.innodb_metrics
+	// counters
+	InnodbMetrics InnodbMetricsConfig `yaml:"innodb_metrics"`
+	// RowEstimates compares the row estimate of a few tables with COUNT(*)
+	RowEstimates RowEstimatesConfig `yaml:"row_estimates"`
+	// TableCheck runs CHECK TABLE on the listed tables, which can lock them
+	TableCheck TableCheckConfig `yaml:"table_check"`
+	// WatchedTables counts matching rows of each table, enabled when not empty
+	WatchedTables []WatchedTableConfig `yaml:"watched_tables"`
+}
+
+// labelNames returns the label names of a metric: cloud_name, the metric's
+// own labels, then the labels shared by all metrics of a database.
+func labelNames(names ...string) []string {
+	labels := append([]string{"cloud_name"}, names...)
+	return append(labels, "origin_prometheus", "environment", "cluster")
+}
+
+// labelValues returns the label values of a metric of this database, in the
+// order given by labelNames.
+func (c DatabaseConfig) labelValues(values ...string) []string {
+	labels := append([]string{c.Name}, values...)
+	return append(labels, c.OriginPrometheus, c.Environment, c.Cluster)
+}
+
+// schemaAllowed reports whether the include/exclude filters allow collecting
+// from the schema
+func (c DatabaseConfig) schemaAllowed(schema string) bool {
+	for _, name := range c.ExcludeDatabases {
+		if schema == name {
+			return false
+		}
+	}
+	if len(c.IncludeDatabases) == 0 {
+		return true
+	}
+	for _, name := range c.IncludeDatabases {
+		if schema == name {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultTrue returns the value of an optional bool setting that defaults to true
+func defaultTrue(b *bool) bool {
+	return b == nil || *b
+}
+
+func (c DatabaseConfig) useCachedStats() bool {
+	return defaultTrue(c.UseCachedStats)
+}
+
+// tableColumn returns column, or NULL when it is not collected
+func tableColumn(column string, collect *bool) string {
+	if defaultTrue(collect) {
+		return column
+	}
+	return "NULL"
+}
+
+func (c DatabaseConfig) schemaTableThreshold() int {
+	if c.SchemaTableThreshold <= 0 {
+		return 10000
+	}
+	return c.SchemaTableThreshold
+}
+
+// ProcesslistConfig configures the processlist collector
+type ProcesslistConfig struct {
+	// QueryOverride replaces SHOW PROCESSLIST, for backends such as
+	// connection poolers that intercept or rewrite SHOW statements. It must
+	// return the columns of SHOW PROCESSLIST first, in order: Id, User, Host,
+	// db, Command, Time, State, Info.
+	QueryOverride string `yaml:"query_override"`
+}
+
+// processlistTable returns the table the processlist is read from, with
+// information_schema.processlist column names
+func (c DatabaseConfig) processlistTable() string {
+	if c.ProcesslistSource == "performance_schema" {
+		return `(
+			SELECT processlist_id AS id, processlist_user AS user, processlist_host AS host,
+				processlist_db AS db, processlist_command AS command, processlist_time AS time,
+				processlist_state AS state, processlist_info AS info
+			FROM performance_schema.threads
+			WHERE processlist_id IS NOT NULL
+		) AS processlist`
+	}
+	return "information_schema.processlist"
+}
+
+// CollectorConfig enables an optional collector. Interval, when set, runs the
+// collector on its own schedule instead of its tier's.
+type CollectorConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// SmoothingConfig enables exponential moving average smoothing of a collector's gauges
+type SmoothingConfig struct {
+	Enabled bool    `yaml:"enabled"`
+	Alpha   float64 `yaml:"alpha"`
+}
+
+const defaultSmoothingAlpha = 0.3
+
+// Previous smoothed values, keyed by metric name and label values
+var (
+	emaMu     sync.Mutex
+	emaValues = make(map[string]float64)
+)
+
+// setSmoothed sets gauge to value, or to alpha*value + (1-alpha)*previous when
+// smoothing is enabled. The unsmoothed value is then exposed on raw.
+func setSmoothed(gauge, raw *prometheus.GaugeVec, name string, smoothing SmoothingConfig, value float64, labels ...string) {
+	if !smoothing.Enabled {
+		gauge.WithLabelValues(labels...).Set(value)
+		return
+	}
+	raw.WithLabelValues(labels...).Set(value)
+
+	alpha := smoothing.Alpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = defaultSmoothingAlpha
+	}
+
+	key := name + "\xff" + strings.Join(labels, "\xff")
+	emaMu.Lock()
+	if prev, ok := emaValues[key]; ok {
+		value = alpha*value + (1-alpha)*prev
+	}
+	emaValues[key] = value
+	emaMu.Unlock()
+
+	gauge.WithLabelValues(labels...).Set(value)
 }
 
-func readConfig(filename string) (Config, error) {
+func readConfig(filename, overlay string) (Config, error) {
 	var config Config
-	data, err := ioutil.ReadFile(filename)
+	data, err := readConfigData(filename, overlay)
 	if err != nil {
 		return config, err
 	}
-	err = yaml.Unmarshal(data, &config)
+	data, err = applyDefaults(data)
 	if err != nil {
 		return config, err
 	}
-	return config, nil
+	err = yaml.Unmarshal(data, &config)
+	return config, err
+}
+
+// redactDSN replaces the password in a DSN with "***" so it can be logged safely.
+func redactDSN(dsn string) string {
+	if cfg, err := mysql.ParseDSN(dsn); err == nil {
+		if cfg.Passwd != "" {
+			cfg.Passwd = "***"
+		}
+		return cfg.FormatDSN()
+	}
+
+	// Fall back to masking everything between the first ':' and the last '@'
+	at := strings.LastIndex(dsn, "@")
+	if at < 0 {
+		return dsn
+	}
+	if colon := strings.Index(dsn[:at], ":"); colon >= 0 {
+		return dsn[:colon+1] + "***" + dsn[at:]
+	}
+	return dsn
+}
+
+var loggedOnce sync.Map
+
+// logOnce logs a message only the first time it is called with the given key,
+// for conditions that would otherwise be reported on every collection.
+func logOnce(key string, format string, args ...interface{}) {
+	if _, loaded := loggedOnce.LoadOrStore(key, struct{}{}); !loaded {
+		log.Printf(format, args...)
+	}
+}
+
+// quoteIdentifier quotes a possibly schema-qualified identifier such as
+// "percona.heartbeat" for use in a query.
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = "`" + strings.ReplaceAll(part, "`", "``") + "`"
+	}
+	return strings.Join(parts, ".")
+}
+
+// isMissingObjectError reports whether err is MySQL's "unknown database",
+// "unknown table in information_schema" or "table doesn't exist" error.
+func isMissingObjectError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1049 || mysqlErr.Number == 1109 || mysqlErr.Number == 1146
+	}
+	return false
 }
 
-func collectConnCount(db *sql.DB, cloudName string, originPrometheus string) {
+// serverMajorVersion returns the major version of a MySQL VERSION() string,
+// or 0 for MariaDB and unparseable versions.
+func serverMajorVersion(version string) int {
+	if strings.Contains(version, "MariaDB") {
+		return 0
+	}
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return major
+}
+
+// useCachedTableStats makes information_schema.tables queries on conn read
+// cached statistics instead of recalculating them, which touches data pages.
+func useCachedTableStats(ctx context.Context, conn *sql.Conn, cloudName string) {
+	var version string
+	if err := conn.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version); err != nil {
+		log.Printf("database %s: Error reading server version: %v", cloudName, err)
+		return
+	}
+
+	if serverMajorVersion(version) >= 8 {
+		// 86400 is the server default; 0 would force a fresh calculation on every query
+		if _, err := conn.ExecContext(ctx, "SET SESSION information_schema_stats_expiry = 86400"); err != nil {
+			log.Printf("database %s: Error setting information_schema_stats_expiry: %v", cloudName, err)
+		}
+		return
+	}
+
+	// innodb_stats_on_metadata is global-only, so we can only warn about it
+	var statsOnMetadata sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT @@innodb_stats_on_metadata").Scan(&statsOnMetadata); err != nil {
+		return
+	}
+	if statsOnMetadata.Int64 == 1 {
+		logOnce("stats-on-metadata:"+cloudName, "database %s: innodb_stats_on_metadata is ON, the table size scan will recalculate statistics", cloudName)
+	}
+}
+
+// queryConnCount returns the top connection counts grouped by user and
+// database, restricted to processlist rows matching filter when it is non-empty.
+func queryConnCount(db queryer, dbConfig DatabaseConfig, filter string) map[string]map[string]int {
+	cloudName := dbConfig.Name
+	where := ""
+	if filter != "" {
+		where = "WHERE " + filter
+	}
 	rows, err := db.Query(`
 		SELECT db, user, count(*) 
-		FROM information_schema.processlist 
+		FROM ` + dbConfig.processlistTable() + `
+		` + where + `
 		GROUP BY db, user 
 		ORDER BY 3 DESC 
 		LIMIT 20
 	`)
 	if err != nil {
 		log.Printf("database %s: Error executing connection count query: %v", cloudName, err)
-		return
+		return nil
 	}
 	defer rows.Close()
 
+	userDbCount := make(map[string]map[string]int)
+
 	for rows.Next() {
 		var dbName, userName sql.NullString
 		var count int
@@ -119,68 +608,350 @@ func collectConnCount(db *sql.DB, cloudName string, originPrometheus string) {
 			user = userName.String
 		}
 
-		connCount.WithLabelValues(cloudName, user, db, originPrometheus).Set(float64(count))
+		if _, exists := userDbCount[user]; !exists {
+			userDbCount[user] = make(map[string]int)
+		}
+		userDbCount[user][db] = count
 	}
+	return userDbCount
 }
 
-func collectMetrics(db *sql.DB, cloudName string, originPrometheus string) {
-	// Collect table size, index size, and row count metrics
-	rows, err := db.Query(`
+func collectConnCount(db queryer, dbConfig DatabaseConfig) {
+	smoothing := dbConfig.Smoothing["conn_count"]
+
+	filter := ""
+	if dbConfig.ExcludeSleeping {
+		filter = "command <> 'Sleep'"
+		for user, dbCounts := range queryConnCount(db, dbConfig, "command = 'Sleep'") {
+			for db, count := range dbCounts {
+				connSleepingCount.WithLabelValues(dbConfig.labelValues(user, db)...).Set(float64(count))
+			}
+		}
+	}
+
+	for user, dbCounts := range queryConnCount(db, dbConfig, filter) {
+		for db, count := range dbCounts {
+			setSmoothed(connCount, connCountRaw, "conn_count", smoothing, float64(count), dbConfig.labelValues(user, db)...)
+		}
+	}
+}
+
+// collectDatabaseConnections counts every connection by its default
+// database, unlike mysql_conn_count which is limited to the top user and
+// database pairs
+func collectDatabaseConnections(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	rows, err := db.Query("SELECT db, COUNT(*) FROM " + dbConfig.processlistTable() + " GROUP BY db")
+	if err != nil {
+		log.Printf("database %s: Error executing database connections query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	// Drop databases nobody is connected to anymore
+	databaseConnections.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for rows.Next() {
+		var dbName sql.NullString
+		var count int
+
+		if err := rows.Scan(&dbName, &count); err != nil {
+			log.Printf("database %s: Error scanning database connections row: %v", cloudName, err)
+			continue
+		}
+
+		name := "UNKNOWN_DB"
+		if dbName.Valid {
+			name = dbName.String
+		}
+		databaseConnections.WithLabelValues(dbConfig.labelValues(name)...).Set(float64(count))
+	}
+}
+
+// querySchemas lists the schemas allowed by the database filters
+func querySchemas(ctx context.Context, conn *sql.Conn, dbConfig DatabaseConfig) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT schema_name FROM information_schema.schemata")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schemas []string
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return nil, err
+		}
+		if dbConfig.schemaAllowed(schema) {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas, rows.Err()
+}
+
+// tableStat sums the information_schema.tables columns of the tables
+// exported under the same labels
+type tableStat struct {
+	dataSize, indexSize, rows float64
+	// expectedSize sums table_rows * avg_row_length, and avgRowLength is
+	// the last table's, for tables without rows
+	expectedSize, avgRowLength float64
+}
+
+func collectTables(s *snapshot) {
+	dbConfig := s.dbConfig
+	cloudName := dbConfig.Name
+	ctx := s.ctx
+
+	// Session settings only apply to a single connection, so pin one for the
+	// scan, unless it runs in the consistent snapshot's
+	var err error
+	conn := s.consistentConn()
+	if conn == nil {
+		conn, err = s.db.Conn(ctx)
+		if err != nil {
+			log.Printf("database %s: Error acquiring connection: %v", cloudName, err)
+			return
+		}
+		defer conn.Close()
+	}
+
+	if dbConfig.useCachedStats() {
+		useCachedTableStats(ctx, conn, cloudName)
+	}
+
+	// Collect table size, index size, and row count metrics. Columns that are
+	// not collected are selected as NULL and never read from the tables.
+	orderBy := "ORDER BY data_length DESC, index_length DESC"
+	if !defaultTrue(dbConfig.CollectDataLength) {
+		orderBy = "ORDER BY " + tableColumn("index_length", dbConfig.CollectIndexLength) + " DESC"
+	}
+	query := `
         SELECT
         table_schema AS ` + "`db_name`" + `,
         table_name AS ` + "`table`" + `,
-        table_rows,
-        data_length AS ` + "`data_size_bytes`" + `,
-        index_length AS ` + "`index_size_bytes`" + `
+        ` + tableColumn("table_rows", dbConfig.CollectTableRows) + `,
+        ` + tableColumn("data_length", dbConfig.CollectDataLength) + ` AS ` + "`data_size_bytes`" + `,
+        ` + tableColumn("index_length", dbConfig.CollectIndexLength) + ` AS ` + "`index_size_bytes`" + `,
+        engine,
+        ` + tableColumn("avg_row_length", dbConfig.CollectTableRows) + `
     	FROM
         information_schema.tables
-    	ORDER BY
-        data_length DESC, index_length DESC`)
-	if err != nil {
-		log.Printf("database %s: Error executing table size query: %v", cloudName, err)
-		return
+    	`
+
+	// One query for all tables, or one per schema with paginate_by_schema so
+	// that no single query has to open every table of a huge instance
+	var schemas []string
+	if dbConfig.PaginateBySchema {
+		schemas, err = querySchemas(ctx, conn, dbConfig)
+		if err != nil {
+			log.Printf("database %s: Error listing schemas: %v", cloudName, err)
+			return
+		}
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var dbName, tableName string
-		var tableRowsVal sql.NullInt64
-		var dataSizeBytes, indexSizeBytes sql.NullFloat64
+	allTables := make(map[[2]string]*tableStat)
+	engineCount := make(map[string]map[string]int)
+	schemaSize := make(map[string]float64)
+
+	scan := func(rows *sql.Rows) {
+		defer rows.Close()
+
+		for rows.Next() {
+			var dbName, tableName string
+			var tableRowsVal sql.NullInt64
+			var dataSizeBytes, indexSizeBytes sql.NullFloat64
+			var engine sql.NullString
+			var avgRowLength sql.NullFloat64
+
+			if err := rows.Scan(&dbName, &tableName, &tableRowsVal, &dataSizeBytes, &indexSizeBytes, &engine, &avgRowLength); err != nil {
+				log.Printf("database %s: Error scanning row: %v", cloudName, err)
+				continue
+			}
+			if !dbConfig.schemaAllowed(dbName) {
+				continue
+			}
+			// Tables rewritten to the same labels are exported as one
+			dbName, tableName = dbConfig.rewriteTable(dbName, tableName)
+			key := [2]string{dbName, tableName}
+
+			stats, seen := allTables[key]
+			if !seen {
+				stats = &tableStat{}
+				allTables[key] = stats
+			}
+			stats.dataSize += dataSizeBytes.Float64
+			stats.indexSize += indexSizeBytes.Float64
+			stats.rows += float64(tableRowsVal.Int64)
+			stats.expectedSize += float64(tableRowsVal.Int64) * avgRowLength.Float64
+			stats.avgRowLength = avgRowLength.Float64
 
-		if err := rows.Scan(&dbName, &tableName, &tableRowsVal, &dataSizeBytes, &indexSizeBytes); err != nil {
-			log.Printf("database %s: Error scanning row: %v", cloudName, err)
+			schemaSize[dbName] += dataSizeBytes.Float64 + indexSizeBytes.Float64
+
+			// Views have no storage engine
+			engineStr := "view"
+			if engine.Valid {
+				engineStr = engine.String
+			}
+			if _, exists := engineCount[dbName]; !exists {
+				engineCount[dbName] = make(map[string]int)
+			}
+			engineCount[dbName][engineStr]++
+		}
+	}
+
+	if !dbConfig.PaginateBySchema {
+		rows, err := conn.QueryContext(ctx, query+orderBy)
+		if err != nil {
+			log.Printf("database %s: Error executing table size query: %v", cloudName, err)
+			return
+		}
+		scan(rows)
+	}
+	for _, schema := range schemas {
+		rows, err := conn.QueryContext(ctx, query+"WHERE table_schema = ? "+orderBy, schema)
+		if err != nil {
+			log.Printf("database %s: Error executing table size query for schema %s: %v", cloudName, schema, err)
 			continue
 		}
+		scan(rows)
+	}
+
+	// The largest tables are exported, across all schemas, in the order of
+	// the query. Schemas scanned one by one and tables rewritten to the same
+	// labels are only ranked once all rows are read.
+	keys := make([][2]string, 0, len(allTables))
+	for key := range allTables {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := allTables[keys[i]], allTables[keys[j]]
+		if a.dataSize != b.dataSize {
+			return a.dataSize > b.dataSize
+		}
+		if a.indexSize != b.indexSize {
+			return a.indexSize > b.indexSize
+		}
+		return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+	})
 
-		tableSize.WithLabelValues(cloudName, dbName, tableName, originPrometheus).Set(dataSizeBytes.Float64)
-		indexSize.WithLabelValues(cloudName, dbName, tableName, originPrometheus).Set(indexSizeBytes.Float64)
-		if tableRowsVal.Valid {
-			tableRows.WithLabelValues(cloudName, dbName, tableName, originPrometheus).Set(float64(tableRowsVal.Int64))
-		} else {
-			tableRows.WithLabelValues(cloudName, dbName, tableName, originPrometheus).Set(0)
+	tableStats := make(map[[2]string]*tableStat)
+	tablesExported := make(map[string]int)
+	otherSize := make(map[string]float64)
+	budget := newSeriesBudget(dbConfig, "tables")
+	defer budget.done()
+	for _, key := range keys {
+		stats := allTables[key]
+		if dbConfig.TopTablesBySize > 0 && tablesExported[key[0]] >= dbConfig.TopTablesBySize || !budget.allow() {
+			otherSize[key[0]] += stats.dataSize + stats.indexSize
+			continue
 		}
+		tablesExported[key[0]]++
+		tableStats[key] = stats
 	}
 
+	// Drop dropped tables and schemas, and tables no longer among the largest
+	for _, vec := range []*prometheus.GaugeVec{
+		tableSize, indexSize, tableRows, tableAvgRowLength, tableBloatRatio,
+		tablesByEngine, databaseSize, tablesOtherSize, schemaTableCount, schemaTableCountOverThreshold,
+	} {
+		vec.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	}
+	for key, stats := range tableStats {
+		labels := dbConfig.labelValues(key[0], key[1])
+		if defaultTrue(dbConfig.CollectDataLength) {
+			tableSize.WithLabelValues(labels...).Set(stats.dataSize)
+		}
+		if defaultTrue(dbConfig.CollectIndexLength) {
+			indexSize.WithLabelValues(labels...).Set(stats.indexSize)
+		}
+		if defaultTrue(dbConfig.CollectTableRows) {
+			avgRowLength := stats.avgRowLength
+			if stats.rows > 0 {
+				avgRowLength = stats.expectedSize / stats.rows
+			}
+			tableRows.WithLabelValues(labels...).Set(stats.rows)
+			tableAvgRowLength.WithLabelValues(labels...).Set(avgRowLength)
+		}
+		// Empty tables and views have no meaningful estimate
+		if stats.expectedSize > 0 && defaultTrue(dbConfig.CollectDataLength) {
+			tableBloatRatio.WithLabelValues(labels...).Set(stats.dataSize / stats.expectedSize)
+		}
+	}
+
+	for dbName, counts := range engineCount {
+		for engine, count := range counts {
+			tablesByEngine.WithLabelValues(dbConfig.labelValues(dbName, engine)...).Set(float64(count))
+		}
+	}
+	for dbName, size := range schemaSize {
+		databaseSize.WithLabelValues(dbConfig.labelValues(dbName)...).Set(size)
+		if dbConfig.TopTablesBySize > 0 || dbConfig.MaxSeriesPerCollector > 0 {
+			tablesOtherSize.WithLabelValues(dbConfig.labelValues(dbName)...).Set(otherSize[dbName])
+		}
+	}
+
+	threshold := dbConfig.schemaTableThreshold()
+	for dbName, counts := range engineCount {
+		tables := 0
+		for _, count := range counts {
+			tables += count
+		}
+		over := 0.0
+		if tables > threshold {
+			over = 1
+		}
+		schemaTableCount.WithLabelValues(dbConfig.labelValues(dbName)...).Set(float64(tables))
+		schemaTableCountOverThreshold.WithLabelValues(dbConfig.labelValues(dbName)...).Set(over)
+	}
+}
+
+func collectProcessList(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
 	// Collect SHOW PROCESSLIST metrics
-	rows, err = db.Query("SHOW PROCESSLIST")
+	query := "SHOW PROCESSLIST"
+	if dbConfig.ProcesslistSource == "performance_schema" {
+		query = "SELECT * FROM " + dbConfig.processlistTable()
+	}
+	if dbConfig.Processlist.QueryOverride != "" {
+		query = dbConfig.Processlist.QueryOverride
+	}
+	rows, err := db.Query(query)
 	if err != nil {
-		log.Printf("database %s: Error executing SHOW PROCESSLIST: %v", cloudName, err)
+		log.Printf("database %s: Error executing %s: %v", cloudName, query, err)
 		return
 	}
 	defer rows.Close()
 
+	// MariaDB appends Progress and Percona Server Rows_sent/Rows_examined.
+	// A query_override returning other columns is reported on its first run.
+	if !checkColumns(rows, dbConfig, "processlist", "Id", "User", "Host", "db", "Command", "Time", "State", "Info") {
+		return
+	}
+	columns, _ := rows.Columns()
+
 	userDbCount := make(map[string]map[string]int)
+	sleepingCount := make(map[string]map[string]int)
+	commandCount := make(map[string]int)
+	ages := make(map[string][]float64)
+	for command := range connectionAgeCommands {
+		ages[command] = nil
+	}
 
 	for rows.Next() {
 		var id int
-		var user, host, command, state, info, progress sql.NullString
+		var user, host, command, state, info sql.NullString
 		var db sql.NullString
 		var time interface{}
 
-		if err := rows.Scan(&id, &user, &host, &db, &command, &time, &state, &info); err != nil {
-			if err1 := rows.Scan(&id, &user, &host, &db, &command, &time, &state, &info, &progress); err1 != nil {
-				continue
-			}
+		dest := []interface{}{&id, &user, &host, &db, &command, &time, &state, &info}
+		for len(dest) < len(columns) {
+			dest = append(dest, new(sql.RawBytes))
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.Printf("database %s: Error scanning SHOW PROCESSLIST row: %v", cloudName, err)
+			continue
 		}
 
 		userStr := "UNKNOWN_USER"
@@ -193,59 +964,327 @@ func collectMetrics(db *sql.DB, cloudName string, originPrometheus string) {
 			dbStr = db.String
 		}
 
-		if _, exists := userDbCount[userStr]; !exists {
-			userDbCount[userStr] = make(map[string]int)
+		commandStr := "UNKNOWN_COMMAND"
+		if command.String != "" {
+			commandStr = command.String
+		}
+		commandCount[commandStr]++
+		if seconds, ok := processlistSeconds(time); ok && connectionAgeCommands[commandStr] {
+			ages[commandStr] = append(ages[commandStr], seconds)
+		}
+
+		counts := userDbCount
+		if dbConfig.ExcludeSleeping && command.String == "Sleep" {
+			counts = sleepingCount
+		}
+		if _, exists := counts[userStr]; !exists {
+			counts[userStr] = make(map[string]int)
 		}
-		userDbCount[userStr][dbStr]++
+		counts[userStr][dbStr]++
 	}
 
 	// Export metrics to Prometheus
+	smoothing := dbConfig.Smoothing["processlist"]
 	for user, dbCounts := range userDbCount {
 		for db, count := range dbCounts {
-			processListCount.WithLabelValues(cloudName, user, db, originPrometheus).Set(float64(count))
+			setSmoothed(processListCount, processListCountRaw, "processlist", smoothing, float64(count), dbConfig.labelValues(user, db)...)
+		}
+	}
+	for user, dbCounts := range sleepingCount {
+		for db, count := range dbCounts {
+			processListSleepingCount.WithLabelValues(dbConfig.labelValues(user, db)...).Set(float64(count))
+		}
+	}
+	// Commands that no process is running any more are dropped
+	processListCommands.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for command, count := range commandCount {
+		processListCommands.WithLabelValues(dbConfig.labelValues(command)...).Set(float64(count))
+	}
+	connectionAge.set(dbConfig, ages)
+}
+
+// runEvery calls collect every interval until done is closed, passing the
+// time the run was scheduled for. A run that overruns its interval delays the
+// next one, and runs missed meanwhile are skipped. Collection is skipped
+// while the database is paused via the admin API or unreachable according
+// to its health check.
+func runEvery(cloudName string, interval time.Duration, done <-chan struct{}, collect func(scheduled time.Time)) {
+	scheduled := time.Now()
+	for {
+		// Only runs that collected keep the series from going stale
+		if !pauses.isPaused(cloudName) && !breakers.isSuspended(cloudName) {
+			collect(scheduled)
+			series.touch(cloudName)
+		}
+
+		scheduled = scheduled.Add(interval)
+		for now := time.Now(); scheduled.Add(interval).Before(now); {
+			scheduled = scheduled.Add(interval)
+		}
+		if !sleep(time.Until(scheduled), done) {
+			return
+		}
+	}
+}
+
+// sleep waits for d, reporting false if done was closed first. A nil done,
+// as used for the databases of the config file, is never closed.
+func sleep(d time.Duration, done <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// validateEnvironment checks environment against the allowed environments,
+// if any are configured
+func validateEnvironment(environment string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, name := range allowed {
+		if environment == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("environment %q is not one of %v", environment, allowed)
+}
+
+// target is an opened database together with its configuration
+type target struct {
+	db     *sql.DB
+	config DatabaseConfig
+}
+
+// startCollectors runs all collectors configured for a database until done
+// is closed
+func startCollectors(db *sql.DB, dbConfig DatabaseConfig, done <-chan struct{}) {
+	go runHealthCheck(db, dbConfig, time.Minute, done)
+	if dbConfig.KeepAlive.enabled() {
+		go keepAlive(db, dbConfig, done)
+	}
+	if dbConfig.SlowLogFile != "" {
+		go tailSlowLog(dbConfig, done)
+	}
+	schedule(db, dbConfig, collectorsFor(dbConfig), done)
+}
+
+// validateDatabase checks the settings of a database entry
+func validateDatabase(dbConfig DatabaseConfig, environments []string) error {
+	if err := validateEnvironment(dbConfig.Environment, environments); err != nil {
+		return err
+	}
+	if err := validateClusterName(dbConfig.Cluster); err != nil {
+		return err
+	}
+	if err := validateProvider(dbConfig.Provider); err != nil {
+		return err
+	}
+	if err := validateCollectors(dbConfig); err != nil {
+		return err
+	}
+	if err := validateKeepAlive(dbConfig); err != nil {
+		return err
+	}
+	if dbConfig.PingTimeout < 0 {
+		return errors.New("ping_timeout must not be negative")
+	}
+	if err := validateWatchedTables(dbConfig.WatchedTables); err != nil {
+		return err
+	}
+	if err := validateLabelRewrites(dbConfig.LabelRewrites); err != nil {
+		return err
+	}
+	if err := dbConfig.TableCheck.validate(); err != nil {
+		return err
+	}
+	if err := dbConfig.InnodbMetrics.validate(); err != nil {
+		return err
+	}
+	if err := dbConfig.RowEstimates.validate(); err != nil {
+		return err
+	}
+	switch dbConfig.Type {
+	case "", "mysql", "proxysql", "vitess":
+	default:
+		return fmt.Errorf("unknown type %q", dbConfig.Type)
+	}
+	switch dbConfig.ProcesslistSource {
+	case "", "processlist", "performance_schema":
+	default:
+		return fmt.Errorf("unknown processlist_source %q", dbConfig.ProcesslistSource)
+	}
+	if dbConfig.Processlist.QueryOverride != "" && dbConfig.ProcesslistSource == "performance_schema" {
+		return errors.New("processlist: query_override cannot be combined with processlist_source performance_schema")
+	}
+	return nil
+}
+
+// targetDSN returns the DSN to open the database with, registering its TLS
+// config with the driver when a tls section is set
+func targetDSN(dbConfig DatabaseConfig) (string, error) {
+	dsn, err := providerDSN(dbConfig)
+	if err != nil {
+		return "", fmt.Errorf("provider %s: %v", dbConfig.Provider, err)
+	}
+	dsn += "?timeout=30s"
+	if dbConfig.TLS.enabled() {
+		param, err := registerClientTLS(dbConfig)
+		if err != nil {
+			return "", fmt.Errorf("tls: %v", err)
 		}
+		dsn += "&" + param
+	} else if param := providerTLSParam(dbConfig); param != "" {
+		dsn += "&" + param
+	}
+	return dsn, nil
+}
+
+// openTarget opens a database and registers it with the pool statistics
+// and the admin API
+func openTarget(dbConfig DatabaseConfig) (target, error) {
+	dsn, err := targetDSN(dbConfig)
+	if err != nil {
+		return target{}, err
+	}
+	db, err := openDB(dbConfig, dsn)
+	if err != nil {
+		return target{}, fmt.Errorf("opening %s: %v", redactDSN(dsn), err)
+	}
+	if len(dbConfig.Hosts) > 0 {
+		log.Printf("database %s: collecting from %s with hosts %v", dbConfig.Name, redactDSN(dsn), dbConfig.Hosts)
+	} else {
+		log.Printf("database %s: collecting from %s", dbConfig.Name, redactDSN(dsn))
 	}
+	db.SetConnMaxIdleTime(dbConfig.ConnMaxIdleTime)
+	pool.add(dbConfig, db)
+	pauses.add(dbConfig)
+	profiles.add(dbConfig)
+	return target{db: db, config: dbConfig}, nil
+}
+
+// metricsHandler serves /metrics, gzip-compressed for scrapers that send
+// Accept-Encoding: gzip
+func metricsHandler(auth BasicAuthConfig) http.Handler {
+	return withBasicAuth(auth, promhttp.Handler())
 }
 
 func main() {
-	config, err := readConfig("config.yaml")
+	overlay := flag.String("config.overlay", "", "Optional YAML file deep-merged over config.yaml")
+	pushGateway := flag.String("push.gateway", "", "Collect once, push the metrics to this Pushgateway URL and exit, instead of serving /metrics")
+	pushJob := flag.String("push.job", "mysql_info_exporter", "Job name to push the metrics under with --push.gateway")
+	testRule := flag.String("test.rule", "", "Collect once, check that the series listed in this YAML file are exported and exit")
+	dump := flag.Bool("dump", false, "Collect once, print the metrics to stdout in the exposition format and exit")
+	flag.Parse()
+
+	config, err := readConfig("config.yaml", *overlay)
 	if err != nil {
 		log.Fatalf("Error reading config file: %v", err)
 	}
+	if err := registerMetrics(config.MetricNamespace); err != nil {
+		log.Fatalf("Error registering metrics with namespace %q: %v", config.MetricNamespace, err)
+	}
 
-	for _, dbConfig := range config.Databases {
-		go func(dbConfig struct {
-			Name             string `yaml:"name"`
-			DSN              string `yaml:"dsn"`
-			OriginPrometheus string `yaml:"origin_prometheus"`
-		}) {
-			dsn := dbConfig.DSN + "?timeout=30s"
-			db, err := sql.Open("mysql", dsn)
+	oneShot := *pushGateway != "" || *testRule != "" || *dump
+	for _, discovery := range config.SRVDiscovery {
+		if err := discovery.validate(config.Environments); err != nil {
+			log.Fatalf("Error in srv_discovery %s: %v", discovery.Service, err)
+		}
+		// A single collection only needs the records of the moment
+		if oneShot {
+			discovered, err := discovery.resolve()
 			if err != nil {
-				log.Fatalf("Error opening database %s: %v", dbConfig.Name, err)
+				log.Fatalf("Error in srv_discovery %s: %v", discovery.Service, err)
 			}
-			defer db.Close()
-
-			cloudName := dbConfig.Name
-			originPrometheus := dbConfig.OriginPrometheus
-
-			// Start connection count collection in a separate goroutine
-			go func() {
-				for {
-					collectConnCount(db, cloudName, originPrometheus)
-					time.Sleep(5 * time.Minute)
-				}
-			}()
-
-			// Original metrics collection
-			for {
-				collectMetrics(db, cloudName, originPrometheus)
-				// Adjust the sleep interval as needed
-				time.Sleep(55 * time.Minute)
-			}
-		}(dbConfig)
+			config.Databases = append(config.Databases, discovered...)
+		}
 	}
 
-	http.Handle("/metrics", promhttp.Handler())
-	log.Fatal(http.ListenAndServe(":18080", nil))
+	if err := assignClusters(config.Databases, config.Clusters); err != nil {
+		log.Fatalf("Error in clusters: %v", err)
+	}
+
+	targets := make(map[string]target)
+	for _, dbConfig := range config.Databases {
+		if err := validateDatabase(dbConfig, config.Environments); err != nil {
+			log.Fatalf("Error in database %s: %v", dbConfig.Name, err)
+		}
+		t, err := openTarget(dbConfig)
+		if err != nil {
+			log.Fatalf("Error in database %s: %v", dbConfig.Name, err)
+		}
+		targets[dbConfig.Name] = t
+	}
+
+	for _, cluster := range config.Clusters {
+		if err := cluster.validate(targets); err != nil {
+			log.Fatalf("Error in cluster %s: %v", cluster.Name, err)
+		}
+	}
+
+	if *testRule != "" {
+		if err := checkExpectations(*testRule, targets, config.Clusters); err != nil {
+			log.Fatalf("Error checking %s: %v", *testRule, err)
+		}
+		log.Printf("all series in %s are exported", *testRule)
+		return
+	}
+	if *dump {
+		if err := dumpOnce(os.Stdout, targets, config.Clusters); err != nil {
+			log.Fatalf("Error dumping metrics: %v", err)
+		}
+		return
+	}
+	if *pushGateway != "" {
+		if err := pushOnce(*pushGateway, *pushJob, targets, config.Clusters); err != nil {
+			log.Fatalf("Error pushing to %s: %v", *pushGateway, err)
+		}
+		log.Printf("pushed metrics to %s", *pushGateway)
+		return
+	}
+
+	live := newTargetSet()
+	for _, t := range targets {
+		live.start(t)
+	}
+	reloader := &configReloader{filename: "config.yaml", overlay: *overlay, targets: live, config: config}
+	go reloader.run()
+
+	if config.StaleSeriesTTL > 0 {
+		go runStaleSweeper(config.StaleSeriesTTL)
+	}
+	for _, cluster := range config.Clusters {
+		go runCluster(cluster, live)
+	}
+	for _, discovery := range config.SRVDiscovery {
+		go runSRVDiscovery(discovery, live)
+	}
+
+	if config.StatsD.Address != "" {
+		go runStatsD(config.StatsD)
+	}
+	if !config.StatsD.Only {
+		http.Handle("/metrics", metricsHandler(config.BasicAuth))
+	}
+	http.Handle("/admin/pause", withBasicAuth(config.BasicAuth, pauseHandler(true)))
+	http.Handle("/admin/resume", withBasicAuth(config.BasicAuth, pauseHandler(false)))
+	http.Handle("/admin/profile", withBasicAuth(config.BasicAuth, profileHandler()))
+	http.Handle("/config", withBasicAuth(config.BasicAuth, configHandler(reloader.current)))
+	http.Handle("/", withBasicAuth(config.BasicAuth, statusPageHandler()))
+
+	tlsConfig, err := serverTLS(config.WebTLS)
+	if err != nil {
+		log.Fatalf("Error in web_tls: %v", err)
+	}
+	go runTLSReloader()
+
+	server := &http.Server{Addr: ":18080", TLSConfig: tlsConfig}
+	if tlsConfig == nil {
+		log.Fatal(server.ListenAndServe())
+	}
+	log.Fatal(server.ListenAndServeTLS("", ""))
 }
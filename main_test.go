@@ -0,0 +1,243 @@
+package main
+
+import (
+	"compress/gzip"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filename, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestReadConfigDefaults(t *testing.T) {
+	filename := writeConfig(t, `
+defaults:
+  name: "ignored"
+  paginate_by_schema: true
+  top_tables_by_size: 50
+  environment: "prod"
+  tiers:
+    fast: 30s
+    slow: 1h
+databases:
+  - name: "inherits"
+  - name: "overrides"
+    paginate_by_schema: false
+    top_tables_by_size: 0
+    tiers:
+      fast: 10s
+srv_discovery:
+  - service: "_mysql._tcp.db.example.com"
+`)
+	config, err := readConfig(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inherits, overrides := config.Databases[0], config.Databases[1]
+	if inherits.Name != "inherits" || !inherits.PaginateBySchema || inherits.TopTablesBySize != 50 || inherits.Environment != "prod" {
+		t.Errorf("defaults not inherited: %+v", inherits)
+	}
+	if overrides.PaginateBySchema {
+		t.Error("paginate_by_schema: false did not override the default true")
+	}
+	if overrides.TopTablesBySize != 0 {
+		t.Errorf("top_tables_by_size: 0 did not override the default, got %d", overrides.TopTablesBySize)
+	}
+	// Nested settings are merged key by key
+	if overrides.Tiers.Fast != 10*time.Second || overrides.Tiers.Slow != time.Hour {
+		t.Errorf("tiers not merged: %+v", overrides.Tiers)
+	}
+
+	discovered := config.SRVDiscovery[0].Database
+	if discovered.Name != "" || !discovered.PaginateBySchema || discovered.TopTablesBySize != 50 {
+		t.Errorf("srv_discovery database did not inherit the defaults: %+v", discovered)
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	for _, tc := range []struct {
+		name, dsn, password, want string
+	}{
+		{"tcp", "root:s3cret@tcp(db.example.com:3306)/app", "s3cret", "root:***@tcp(db.example.com:3306)/app"},
+		{"socket", "root:s3cret@unix(/var/run/mysqld/mysqld.sock)/app", "s3cret", "root:***@unix(/var/run/mysqld/mysqld.sock)/app"},
+		{"params", "root:s3cret@tcp(10.0.0.1:3306)/app?timeout=30s&tls=skip-verify", "s3cret", "root:***@tcp(10.0.0.1:3306)/app?timeout=30s&tls=skip-verify"},
+		{"password with @ and :", "root:p@ss:word@tcp(db:3306)/", "p@ss:word", "root:***@tcp(db:3306)/"},
+		{"no password", "root@tcp(localhost:3306)/", "", "root@tcp(localhost:3306)/"},
+		{"unparsable", "not a dsn user:pw@host", "pw", "not a dsn user:***@host"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := redactDSN(tc.dsn)
+			if tc.password != "" && strings.Contains(got, tc.password) {
+				t.Errorf("redactDSN(%q) = %q contains the password", tc.dsn, got)
+			}
+			if got != tc.want {
+				t.Errorf("redactDSN(%q) = %q, want %q", tc.dsn, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMetricsHandlerGzip(t *testing.T) {
+	auth := BasicAuthConfig{Username: "prometheus", Password: "secret"}
+	server := httptest.NewServer(metricsHandler(auth))
+	defer server.Close()
+
+	// The transport would otherwise ask for gzip itself and decompress the
+	// body, hiding the Content-Encoding header
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	for _, acceptEncoding := range []string{"gzip", ""} {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth(auth.Username, auth.Password)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d, want 200", resp.StatusCode)
+		}
+
+		encoding := resp.Header.Get("Content-Encoding")
+		if acceptEncoding == "" {
+			if encoding != "" {
+				t.Errorf("Content-Encoding %q without Accept-Encoding, want none", encoding)
+			}
+			continue
+		}
+		if encoding != "gzip" {
+			t.Fatalf("Content-Encoding %q with Accept-Encoding: gzip, want gzip", encoding)
+		}
+		body, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			t.Fatalf("body is not gzip: %v", err)
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "# TYPE ") {
+			t.Errorf("decompressed body is not the metrics exposition: %.100q", data)
+		}
+	}
+}
+
+// tablesQuery answers the queries of collectTables with tables, given as
+// schema.table to data size, in the order the server would return them
+func tablesQuery(tables ...interface{}) fakeQuery {
+	return func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case query == "SELECT VERSION()":
+			return []string{"VERSION()"}, [][]driver.Value{{"8.0.36"}}, nil
+		case strings.Contains(query, "FROM information_schema.schemata"):
+			schemas := make(map[string]bool)
+			var rows [][]driver.Value
+			for i := 0; i < len(tables); i += 2 {
+				schema, _, _ := strings.Cut(tables[i].(string), ".")
+				if !schemas[schema] {
+					schemas[schema] = true
+					rows = append(rows, []driver.Value{schema})
+				}
+			}
+			return []string{"schema_name"}, rows, nil
+		case strings.Contains(query, "information_schema.tables"):
+			var rows [][]driver.Value
+			for i := 0; i < len(tables); i += 2 {
+				schema, table, _ := strings.Cut(tables[i].(string), ".")
+				if len(args) == 1 && args[0] != schema {
+					continue
+				}
+				rows = append(rows, []driver.Value{schema, table, int64(10), tables[i+1], float64(0), "InnoDB", float64(1)})
+			}
+			return []string{"db_name", "table", "table_rows", "data_size_bytes", "index_size_bytes", "engine", "avg_row_length"}, rows, nil
+		}
+		return nil, nil, fmt.Errorf("unexpected query %q", query)
+	}
+}
+
+func TestCollectTablesDeletesTablesLeavingTopN(t *testing.T) {
+	dbConfig := DatabaseConfig{Name: "top-tables", TopTablesBySize: 2}
+
+	collectTables(newSnapshot(openFakeDB(t, tablesQuery("app.a", 300.0, "app.b", 200.0, "app.c", 100.0)), dbConfig))
+	if got := collectedSeries(t, tableSize, dbConfig.Name, "database", "table"); len(got) != 2 || got["app.a"] != 300 || got["app.b"] != 200 {
+		t.Fatalf("mysql_table_size_bytes = %v, want app.a and app.b", got)
+	}
+
+	// c grew past b
+	collectTables(newSnapshot(openFakeDB(t, tablesQuery("app.c", 400.0, "app.a", 300.0, "app.b", 200.0)), dbConfig))
+	got := collectedSeries(t, tableSize, dbConfig.Name, "database", "table")
+	if len(got) != 2 || got["app.c"] != 400 || got["app.a"] != 300 {
+		t.Errorf("mysql_table_size_bytes = %v, want app.c and app.a only", got)
+	}
+	if rows := collectedSeries(t, tableRows, dbConfig.Name, "database", "table"); len(rows) != 2 {
+		t.Errorf("mysql_table_rows = %v, want 2 series", rows)
+	}
+	if other := collectedSeries(t, tablesOtherSize, dbConfig.Name, "database"); other["app"] != 200 {
+		t.Errorf("mysql_tables_other_size_bytes = %v, want only app.b's 200", other)
+	}
+
+	collectTables(newSnapshot(openFakeDB(t, tablesQuery()), dbConfig))
+	if got := collectedSeries(t, databaseSize, dbConfig.Name, "database"); len(got) != 0 {
+		t.Errorf("mysql_database_size_bytes = %v after the schema was dropped, want none", got)
+	}
+}
+
+func TestCollectTablesBudgetKeepsLargestTables(t *testing.T) {
+	// Schemas are scanned in order, small before big
+	db := openFakeDB(t, tablesQuery("small.a", 10.0, "small.b", 5.0, "big.a", 500.0, "big.b", 400.0, "big.c", 300.0))
+	dbConfig := DatabaseConfig{Name: "budget-tables", PaginateBySchema: true, MaxSeriesPerCollector: 2}
+
+	captureLog(t, func() { collectTables(newSnapshot(db, dbConfig)) })
+	got := collectedSeries(t, tableSize, dbConfig.Name, "database", "table")
+	if len(got) != 2 || got["big.a"] != 500 || got["big.b"] != 400 {
+		t.Errorf("mysql_table_size_bytes = %v, want big.a and big.b", got)
+	}
+	other := collectedSeries(t, tablesOtherSize, dbConfig.Name, "database")
+	if other["big"] != 300 || other["small"] != 15 {
+		t.Errorf("mysql_tables_other_size_bytes = %v, want big 300 and small 15", other)
+	}
+}
+
+func TestCollectCharsetFiltersSchemasAndDeletesDroppedTables(t *testing.T) {
+	tables := [][]driver.Value{
+		{"app", "a", "utf8mb4", "utf8mb4_0900_ai_ci"},
+		{"app", "b", "latin1", "latin1_swedish_ci"},
+		{"mysql", "user", "utf8mb3", "utf8mb3_bin"},
+	}
+	db := openFakeDB(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return []string{"table_schema", "table_name", "character_set_name", "table_collation"}, tables, nil
+	})
+	dbConfig := DatabaseConfig{Name: "charset", ExcludeDatabases: []string{"mysql"}}
+
+	collectCharset(db, dbConfig)
+	if got := collectedSeries(t, tableCharsetInfo, dbConfig.Name, "database", "table"); len(got) != 2 || got["app.a"] != 1 || got["app.b"] != 1 {
+		t.Fatalf("mysql_table_charset_info = %v, want app.a and app.b only", got)
+	}
+
+	// b was dropped
+	tables = tables[:1]
+	collectCharset(db, dbConfig)
+	if got := collectedSeries(t, tableCharsetInfo, dbConfig.Name, "database", "table"); len(got) != 1 || got["app.a"] != 1 {
+		t.Errorf("mysql_table_charset_info = %v after app.b was dropped, want app.a only", got)
+	}
+}
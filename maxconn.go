@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	maxUsedConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_max_used_connections",
+			Help: "Highest number of simultaneous connections since server start (Max_used_connections).",
+		},
+		labelNames(),
+	)
+	maxConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_max_connections",
+			Help: "Maximum number of simultaneous client connections (max_connections).",
+		},
+		labelNames(),
+	)
+	maxUsedConnectionsRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_max_used_connections_ratio",
+			Help: "Max_used_connections divided by max_connections.",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(maxUsedConnections)
+	mustRegisterVec(maxConnections)
+	mustRegisterVec(maxUsedConnectionsRatio)
+}
+
+// collectMaxUsedConnections derives the connection high-water mark from the
+// cycle's snapshot, so the ratio uses the limit of the same cycle
+func collectMaxUsedConnections(s *snapshot) {
+	dbConfig := s.dbConfig
+
+	// global_status already logged a failed status query
+	status, err := s.globalStatus()
+	if err != nil {
+		return
+	}
+	used, err := strconv.ParseFloat(status["Max_used_connections"], 64)
+	if err != nil {
+		return
+	}
+	maxUsedConnections.WithLabelValues(dbConfig.labelValues()...).Set(used)
+
+	variables, _ := s.globalVariables()
+	if limit, err := strconv.ParseFloat(variables["max_connections"], 64); err == nil && limit > 0 {
+		maxConnections.WithLabelValues(dbConfig.labelValues()...).Set(limit)
+		maxUsedConnectionsRatio.WithLabelValues(dbConfig.labelValues()...).Set(used / limit)
+	}
+}
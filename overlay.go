@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// readYAML reads a YAML file into generic maps and lists
+func readYAML(filename string) (interface{}, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	err = yaml.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// mergeOverlay deep-merges overlay over base: maps are merged key by key,
+// the databases list is merged entry by entry by name, and any other value,
+// including other lists, in overlay replaces the one in base.
+func mergeOverlay(base, overlay interface{}) interface{} {
+	baseMap, ok := base.(map[interface{}]interface{})
+	overlayMap, ok2 := overlay.(map[interface{}]interface{})
+	if !ok || !ok2 {
+		return overlay
+	}
+
+	merged := make(map[interface{}]interface{}, len(baseMap))
+	for key, value := range baseMap {
+		merged[key] = value
+	}
+	for key, value := range overlayMap {
+		if key == "databases" {
+			merged[key] = mergeDatabases(merged[key], value)
+		} else if existing, ok := merged[key]; ok {
+			merged[key] = mergeOverlay(existing, value)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// mergeDatabases merges each overlay database into the base database of the
+// same name. Databases only in the overlay are appended.
+func mergeDatabases(base, overlay interface{}) interface{} {
+	baseList, ok := base.([]interface{})
+	overlayList, ok2 := overlay.([]interface{})
+	if !ok || !ok2 {
+		return overlay
+	}
+
+	merged := append([]interface{}{}, baseList...)
+	for _, db := range overlayList {
+		found := false
+		for i, existing := range merged {
+			if databaseName(existing) != "" && databaseName(existing) == databaseName(db) {
+				merged[i] = mergeOverlay(existing, db)
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, db)
+		}
+	}
+	return merged
+}
+
+// databaseName returns the name of a database entry, or "" if it has none
+func databaseName(db interface{}) string {
+	if m, ok := db.(map[interface{}]interface{}); ok {
+		if name, ok := m["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// applyDefaults merges the defaults section of the YAML config into every
+// database entry, including the database of each srv_discovery entry, with
+// mergeOverlay. Merging the YAML rather than the decoded structs lets an
+// entry set false or 0 over a non-zero default.
+func applyDefaults(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	root, ok := doc.(map[interface{}]interface{})
+	if !ok {
+		return data, nil
+	}
+	defaults, ok := root["defaults"].(map[interface{}]interface{})
+	if !ok {
+		return data, nil
+	}
+
+	// A name identifies a single database and is never inherited
+	inherited := make(map[interface{}]interface{}, len(defaults))
+	for key, value := range defaults {
+		if key != "name" {
+			inherited[key] = value
+		}
+	}
+	withDefaults := func(db interface{}) interface{} {
+		if db == nil {
+			return inherited
+		}
+		return mergeOverlay(inherited, db)
+	}
+
+	if databases, ok := root["databases"].([]interface{}); ok {
+		for i, db := range databases {
+			databases[i] = withDefaults(db)
+		}
+	}
+	if discoveries, ok := root["srv_discovery"].([]interface{}); ok {
+		for _, discovery := range discoveries {
+			if m, ok := discovery.(map[interface{}]interface{}); ok {
+				m["database"] = withDefaults(m["database"])
+			}
+		}
+	}
+	return yaml.Marshal(root)
+}
+
+// readConfigData returns the YAML of filename with overlay, when set,
+// merged over it
+func readConfigData(filename, overlay string) ([]byte, error) {
+	if overlay == "" {
+		return ioutil.ReadFile(filename)
+	}
+	base, err := readYAML(filename)
+	if err != nil {
+		return nil, err
+	}
+	over, err := readYAML(overlay)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(mergeOverlay(base, over))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	partitionRows = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_partition_rows",
+			Help: "Number of rows in each partition of partitioned MySQL tables.",
+		},
+		labelNames("database", "table", "partition"),
+	)
+	partitionSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_partition_size_bytes",
+			Help: "Size of data and indexes in each partition of partitioned MySQL tables, in bytes.",
+		},
+		labelNames("database", "table", "partition"),
+	)
+)
+
+func init() {
+	mustRegisterVec(partitionRows)
+	mustRegisterVec(partitionSize)
+}
+
+// PartitionsConfig configures per-partition collection of partitioned tables
+type PartitionsConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// MaxPerTable limits each table to its largest partitions. Defaults to 100.
+	MaxPerTable int `yaml:"max_per_table"`
+}
+
+func (c PartitionsConfig) maxPerTable() int {
+	if c.MaxPerTable <= 0 {
+		return 100
+	}
+	return c.MaxPerTable
+}
+
+// partitionStats are the rows and size of a partition
+type partitionStats struct {
+	rows, size float64
+}
+
+func collectPartitions(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	// Subpartitions are summed into their partition
+	rows, err := db.Query(`
+		SELECT table_schema, table_name, partition_name,
+			SUM(table_rows), SUM(data_length + index_length) AS size
+		FROM information_schema.partitions
+		WHERE partition_name IS NOT NULL
+		GROUP BY table_schema, table_name, partition_name
+		ORDER BY table_schema, table_name, size DESC
+	`)
+	if err != nil {
+		log.Printf("database %s: Error executing partition query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	maxPerTable := dbConfig.Partitions.maxPerTable()
+	perTable := make(map[[2]string]int)
+	partitions := make(map[[3]string]partitionStats)
+	budget := newSeriesBudget(dbConfig, "partitions")
+	defer budget.done()
+
+	for rows.Next() {
+		var dbName, tableName, partitionName string
+		var rowCount, size sql.NullFloat64
+
+		if err := rows.Scan(&dbName, &tableName, &partitionName, &rowCount, &size); err != nil {
+			log.Printf("database %s: Error scanning partition row: %v", cloudName, err)
+			continue
+		}
+		if !dbConfig.schemaAllowed(dbName) {
+			continue
+		}
+
+		// Partitions of tables rewritten to the same labels are summed
+		dbName, tableName = dbConfig.rewriteTable(dbName, tableName)
+		key := [3]string{dbName, tableName, partitionName}
+		if stats, exported := partitions[key]; exported {
+			partitions[key] = partitionStats{stats.rows + rowCount.Float64, stats.size + size.Float64}
+			continue
+		}
+		table := [2]string{dbName, tableName}
+		if perTable[table] >= maxPerTable || !budget.allow() {
+			continue
+		}
+		perTable[table]++
+		partitions[key] = partitionStats{rowCount.Float64, size.Float64}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing partition query: %v", cloudName, err)
+		return
+	}
+
+	// Drop dropped or reorganized partitions and those no longer among the
+	// largest of their table
+	partitionRows.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	partitionSize.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for key, stats := range partitions {
+		partitionRows.WithLabelValues(dbConfig.labelValues(key[0], key[1], key[2])...).Set(stats.rows)
+		partitionSize.WithLabelValues(dbConfig.labelValues(key[0], key[1], key[2])...).Set(stats.size)
+	}
+}
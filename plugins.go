@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var pluginInfo = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_plugin_info",
+		Help: "Installed server plugin, by type and status (ACTIVE, INACTIVE, DISABLED, DELETED), value is always 1.",
+	},
+	labelNames("name", "type", "status"),
+)
+
+func init() {
+	mustRegisterVec(pluginInfo)
+}
+
+func collectPlugins(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	rows, err := db.Query("SELECT plugin_name, plugin_type, plugin_status FROM information_schema.plugins")
+	if err != nil {
+		log.Printf("database %s: Error executing plugins query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	// Drop uninstalled plugins and old statuses
+	pluginInfo.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for rows.Next() {
+		var name, pluginType, status string
+		if err := rows.Scan(&name, &pluginType, &status); err != nil {
+			log.Printf("database %s: Error scanning plugins row: %v", cloudName, err)
+			continue
+		}
+		pluginInfo.WithLabelValues(dbConfig.labelValues(name, pluginType, status)...).Set(1)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing plugins query: %v", cloudName, err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector exports database/sql connection pool statistics of the
+// exporter's own connections. It reads db.Stats() on every scrape and never
+// queries MySQL.
+type poolCollector struct {
+	mu  sync.Mutex
+	dbs map[string]poolTarget
+
+	openConnections *prometheus.Desc
+	inUse           *prometheus.Desc
+	idle            *prometheus.Desc
+	waitCount       *prometheus.Desc
+	waitDuration    *prometheus.Desc
+	maxIdleClosed   *prometheus.Desc
+}
+
+type poolTarget struct {
+	db     *sql.DB
+	config DatabaseConfig
+}
+
+var pool = newPoolCollector()
+
+func init() {
+	mustRegisterCollector(pool)
+}
+
+func newPoolCollector() *poolCollector {
+	labels := labelNames()
+	return &poolCollector{
+		dbs:             make(map[string]poolTarget),
+		openConnections: prometheus.NewDesc("mysql_exporter_pool_open_connections", "Number of established connections in the exporter's pool, both in use and idle.", labels, nil),
+		inUse:           prometheus.NewDesc("mysql_exporter_pool_in_use_connections", "Number of connections in the exporter's pool currently in use.", labels, nil),
+		idle:            prometheus.NewDesc("mysql_exporter_pool_idle_connections", "Number of idle connections in the exporter's pool.", labels, nil),
+		waitCount:       prometheus.NewDesc("mysql_exporter_pool_wait_count_total", "Total number of times the exporter waited for a pooled connection.", labels, nil),
+		waitDuration:    prometheus.NewDesc("mysql_exporter_pool_wait_duration_seconds_total", "Total time the exporter spent waiting for a pooled connection, in seconds.", labels, nil),
+		maxIdleClosed:   prometheus.NewDesc("mysql_exporter_pool_max_idle_closed_total", "Total number of connections closed due to the pool's max idle limit.", labels, nil),
+	}
+}
+
+// add starts exporting pool statistics for db
+func (c *poolCollector) add(dbConfig DatabaseConfig, db *sql.DB) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dbs[dbConfig.Name] = poolTarget{db: db, config: dbConfig}
+}
+
+// remove stops exporting pool statistics for cloudName
+func (c *poolCollector) remove(cloudName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.dbs, cloudName)
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openConnections
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, target := range c.dbs {
+		stats := target.db.Stats()
+		labels := target.config.labelValues()
+		ch <- prometheus.MustNewConstMetric(c.openConnections, prometheus.GaugeValue, float64(stats.OpenConnections), labels...)
+		ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse), labels...)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle), labels...)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), labels...)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), labels...)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed), labels...)
+	}
+}
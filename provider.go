@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Providers adjusting the connection for the quirks of a managed MySQL
+// service
+const (
+	providerGeneric = "generic"
+	providerAzure   = "azure"
+	providerGCP     = "gcp"
+)
+
+// Azure Database for MySQL server hosts end with this suffix, and the first
+// label is the server name
+const azureHostSuffix = ".mysql.database.azure.com"
+
+func validateProvider(provider string) error {
+	switch provider {
+	case "", providerGeneric, providerAzure, providerGCP:
+		return nil
+	}
+	return fmt.Errorf("provider %q must be generic, azure or gcp", provider)
+}
+
+// providerDSN returns the DSN of the database adjusted for its provider.
+// Azure Single Server only accepts user names of the form user@server.
+func providerDSN(dbConfig DatabaseConfig) (string, error) {
+	if dbConfig.Provider != providerAzure {
+		return dbConfig.DSN, nil
+	}
+	cfg, err := mysql.ParseDSN(dbConfig.DSN)
+	if err != nil {
+		return "", err
+	}
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(host, azureHostSuffix) && !strings.Contains(cfg.User, "@") {
+		cfg.User += "@" + strings.TrimSuffix(host, azureHostSuffix)
+	}
+	return cfg.FormatDSN(), nil
+}
+
+// providerTLSParam returns the DSN parameter for the TLS a provider enforces
+// when no tls section is configured. Azure servers require TLS by default
+// and present certificates from public CAs.
+func providerTLSParam(dbConfig DatabaseConfig) string {
+	if dbConfig.Provider == providerAzure {
+		return "tls=true"
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var proxysqlPoolLabels = labelNames("hostgroup", "srv_host", "srv_port")
+
+var (
+	proxysqlConnUsed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxysql_connection_pool_conn_used",
+			Help: "Number of connections ProxySQL is currently using to send queries to the backend.",
+		},
+		proxysqlPoolLabels,
+	)
+	proxysqlConnFree = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxysql_connection_pool_conn_free",
+			Help: "Number of idle connections ProxySQL keeps open to the backend.",
+		},
+		proxysqlPoolLabels,
+	)
+	proxysqlConnOK = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxysql_connection_pool_conn_ok_total",
+			Help: "Number of connections ProxySQL established to the backend successfully.",
+		},
+		proxysqlPoolLabels,
+	)
+	proxysqlConnErr = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxysql_connection_pool_conn_err_total",
+			Help: "Number of connections ProxySQL failed to establish to the backend.",
+		},
+		proxysqlPoolLabels,
+	)
+	proxysqlQueries = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxysql_connection_pool_queries_total",
+			Help: "Number of queries ProxySQL routed to the backend.",
+		},
+		proxysqlPoolLabels,
+	)
+	proxysqlLatency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxysql_connection_pool_latency_seconds",
+			Help: "Ping latency from ProxySQL to the backend, in seconds.",
+		},
+		proxysqlPoolLabels,
+	)
+	proxysqlStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxysql_connection_pool_status",
+			Help: "Backend status in ProxySQL: 1=ONLINE, 2=SHUNNED, 3=OFFLINE_SOFT, 4=OFFLINE_HARD, 0=other.",
+		},
+		proxysqlPoolLabels,
+	)
+)
+
+func init() {
+	mustRegisterVec(proxysqlConnUsed)
+	mustRegisterVec(proxysqlConnFree)
+	mustRegisterVec(proxysqlConnOK)
+	mustRegisterVec(proxysqlConnErr)
+	mustRegisterVec(proxysqlQueries)
+	mustRegisterVec(proxysqlLatency)
+	mustRegisterVec(proxysqlStatus)
+}
+
+var proxysqlStatusValues = map[string]float64{
+	"ONLINE":       1,
+	"SHUNNED":      2,
+	"OFFLINE_SOFT": 3,
+	"OFFLINE_HARD": 4,
+}
+
+// collectProxySQL reads stats.stats_mysql_connection_pool from a ProxySQL
+// admin interface. ProxySQL returns every value as text, so the columns are
+// matched by name and parsed here.
+func collectProxySQL(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	rows, err := queryRowMaps(db, "SELECT * FROM stats.stats_mysql_connection_pool")
+	if err != nil {
+		log.Printf("database %s: Error executing ProxySQL connection pool query: %v", cloudName, err)
+		return
+	}
+
+	// Backends removed from the pool no longer have a row
+	for _, vec := range []metricVec{proxysqlConnUsed, proxysqlConnFree, proxysqlConnOK, proxysqlConnErr, proxysqlQueries, proxysqlLatency, proxysqlStatus} {
+		vec.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	}
+	for _, row := range rows {
+		number := func(column string) float64 {
+			value, _ := strconv.ParseFloat(row[column], 64)
+			return value
+		}
+
+		labels := dbConfig.labelValues(row["hostgroup"], row["srv_host"], row["srv_port"])
+		proxysqlConnUsed.WithLabelValues(labels...).Set(number("connused"))
+		proxysqlConnFree.WithLabelValues(labels...).Set(number("connfree"))
+		proxysqlConnOK.set(labels, number("connok"))
+		proxysqlConnErr.set(labels, number("connerr"))
+		proxysqlQueries.set(labels, number("queries"))
+		proxysqlLatency.WithLabelValues(labels...).Set(number("latency_us") / 1e6)
+		proxysqlStatus.WithLabelValues(labels...).Set(proxysqlStatusValues[row["status"]])
+	}
+}
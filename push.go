@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// pushOnce collects once from every database and cluster and pushes all
+// metrics to a Pushgateway, for targets that are collected by a cron job
+// rather than scraped
+func pushOnce(url, job string, targets map[string]target, clusters []ClusterConfig) error {
+	collectAll(targets, clusters)
+	return push.New(url, job).Gatherer(prometheus.DefaultGatherer).Push()
+}
+
+// collectAll runs every enabled collector of every database, then of every
+// cluster, once
+func collectAll(targets map[string]target, clusters []ClusterConfig) {
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			err := ping(t.db, t.config)
+			up := 1.0
+			if err != nil {
+				up = 0
+			}
+			mysqlUp.WithLabelValues(t.config.labelValues()...).Set(up)
+			if err != nil {
+				return
+			}
+			collectOnce(t.db, t.config)
+		}(t)
+	}
+	wg.Wait()
+
+	for _, cluster := range clusters {
+		collectCluster(cluster, targets)
+	}
+}
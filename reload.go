@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	reloadsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "mysql_exporter_reloads_total",
+			Help: "Number of config reloads on SIGHUP, successful or not.",
+		},
+	)
+	lastReloadSuccessful = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mysql_exporter_last_reload_successful",
+			Help: "Whether the last config reload was applied, 1 for success and 0 when the previous config was kept.",
+		},
+	)
+	lastReloadSuccessTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mysql_exporter_last_reload_success_timestamp_seconds",
+			Help: "Unix timestamp of the last successful config reload, or of startup.",
+		},
+	)
+)
+
+func init() {
+	mustRegisterCollector(reloadsTotal)
+	mustRegisterCollector(lastReloadSuccessful)
+	mustRegisterCollector(lastReloadSuccessTimestamp)
+}
+
+// targetSet holds the databases of the config file being collected, each
+// until its stop channel is closed. Reloads replace them while the clusters
+// and SRV discovery read them.
+type targetSet struct {
+	mu      sync.RWMutex
+	targets map[string]target
+	stops   map[string]chan struct{}
+}
+
+func newTargetSet() *targetSet {
+	return &targetSet{targets: make(map[string]target), stops: make(map[string]chan struct{})}
+}
+
+// snapshot returns the current databases, keyed by cloud_name
+func (s *targetSet) snapshot() map[string]target {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	targets := make(map[string]target, len(s.targets))
+	for name, t := range s.targets {
+		targets[name] = t
+	}
+	return targets
+}
+
+// start adds an opened database and starts its collectors. It is called
+// with s.mu held, or before the set is shared.
+func (s *targetSet) start(t target) {
+	stop := make(chan struct{})
+	s.targets[t.config.Name] = t
+	s.stops[t.config.Name] = stop
+	go startCollectors(t.db, t.config, stop)
+}
+
+// apply makes the databases match databases, keeping those whose settings
+// did not change and restarting the others. Settings changed in any way
+// restart the database, as its labels or connection may depend on them.
+func (s *targetSet) apply(databases []DatabaseConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]DatabaseConfig)
+	for _, dbConfig := range databases {
+		wanted[dbConfig.Name] = dbConfig
+	}
+	for name, t := range s.targets {
+		if dbConfig, ok := wanted[name]; ok && reflect.DeepEqual(dbConfig, t.config) {
+			continue
+		}
+		close(s.stops[name])
+		delete(s.targets, name)
+		delete(s.stops, name)
+		removeTarget(t)
+		if _, ok := wanted[name]; !ok {
+			log.Printf("database %s: removed by config reload", name)
+		}
+	}
+
+	var failed []string
+	for _, dbConfig := range databases {
+		if _, ok := s.targets[dbConfig.Name]; ok {
+			continue
+		}
+		t, err := openTarget(dbConfig)
+		if err != nil {
+			log.Printf("database %s: Error opening database on config reload: %v", dbConfig.Name, err)
+			failed = append(failed, dbConfig.Name)
+			continue
+		}
+		s.start(t)
+		log.Printf("database %s: started by config reload", dbConfig.Name)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("applied, but databases %v could not be opened and are not collected", failed)
+	}
+	return nil
+}
+
+// configReloader re-reads the config file on SIGHUP and applies its databases.
+// The other sections are read at startup only.
+type configReloader struct {
+	filename, overlay string
+	targets           *targetSet
+
+	mu     sync.Mutex
+	config Config
+}
+
+// current returns the running config
+func (r *configReloader) current() Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.config
+}
+
+// reload applies the databases of the config file. A config that does not
+// read or validate is rejected as a whole, keeping the running databases.
+func (r *configReloader) reload() error {
+	config, err := readConfig(r.filename, r.overlay)
+	if err != nil {
+		return fmt.Errorf("keeping the previous config: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	running := r.config
+
+	// Defaults only apply through the databases they are merged into
+	unchanged := func(c Config) Config {
+		c.Defaults, c.Databases = DatabaseConfig{}, nil
+		return c
+	}
+	if !reflect.DeepEqual(unchanged(config), unchanged(running)) {
+		log.Printf("WARN config sections other than defaults and databases changed; restart the exporter to apply them")
+	}
+
+	databases := config.Databases
+	if err := checkDatabases(databases, running); err != nil {
+		return fmt.Errorf("keeping the previous config: %v", err)
+	}
+	err = r.targets.apply(databases)
+	running.Defaults, running.Databases = config.Defaults, databases
+	r.config = running
+	return err
+}
+
+// checkDatabases validates reloaded databases against the running clusters
+// and environments, without opening them
+func checkDatabases(databases []DatabaseConfig, running Config) error {
+	if err := assignClusters(databases, running.Clusters); err != nil {
+		return fmt.Errorf("clusters: %v", err)
+	}
+	configs := make(map[string]target)
+	for _, dbConfig := range databases {
+		if _, ok := configs[dbConfig.Name]; ok {
+			return fmt.Errorf("database %s is listed twice", dbConfig.Name)
+		}
+		if err := validateDatabase(dbConfig, running.Environments); err != nil {
+			return fmt.Errorf("database %s: %v", dbConfig.Name, err)
+		}
+		if _, err := providerDSN(dbConfig); err != nil {
+			return fmt.Errorf("database %s: provider %s: %v", dbConfig.Name, dbConfig.Provider, err)
+		}
+		if err := checkClientTLS(dbConfig); err != nil {
+			return fmt.Errorf("database %s: tls: %v", dbConfig.Name, err)
+		}
+		configs[dbConfig.Name] = target{config: dbConfig}
+	}
+	for _, cluster := range running.Clusters {
+		if err := cluster.validate(configs); err != nil {
+			return fmt.Errorf("cluster %s: %v", cluster.Name, err)
+		}
+	}
+
+	discoveredMu.Lock()
+	defer discoveredMu.Unlock()
+	for name := range configs {
+		if d, ok := discovered[name]; ok {
+			return fmt.Errorf("database %s is already discovered by srv_discovery %s", name, d.service)
+		}
+	}
+	return nil
+}
+
+// run reloads the config on every SIGHUP, forever
+func (r *configReloader) run() {
+	// Startup applied the config, or exited
+	lastReloadSuccessful.Set(1)
+	lastReloadSuccessTimestamp.SetToCurrentTime()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		r.reloadAndRecord()
+	}
+}
+
+// reloadAndRecord reloads the config and records the outcome in the reload
+// metrics
+func (r *configReloader) reloadAndRecord() {
+	reloadsTotal.Inc()
+	if err := r.reload(); err != nil {
+		log.Printf("WARN Error reloading config: %v", err)
+		lastReloadSuccessful.Set(0)
+		return
+	}
+	log.Printf("reloaded config")
+	lastReloadSuccessful.Set(1)
+	lastReloadSuccessTimestamp.SetToCurrentTime()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConfigReload(t *testing.T) {
+	// Nothing listens on port 1, so the collectors fail without a server
+	filename := writeConfig(t, `
+databases:
+  - name: reload-a
+    dsn: "exporter@tcp(127.0.0.1:1)/"
+  - name: reload-b
+    dsn: "exporter@tcp(127.0.0.1:1)/"
+`)
+	config, err := readConfig(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := newTargetSet()
+	for _, dbConfig := range config.Databases {
+		target, err := openTarget(dbConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		live.start(target)
+	}
+	t.Cleanup(func() { live.apply(nil) })
+	r := &configReloader{filename: filename, targets: live, config: config}
+	before := live.snapshot()
+
+	reloads := gaugeValue(t, reloadsTotal)
+	for _, invalid := range []string{
+		"databases: [",
+		"databases:\n  - name: reload-a\n    dsn: \"exporter@tcp(127.0.0.1:1)/\"\n  - name: reload-a\n    dsn: \"exporter@tcp(127.0.0.1:1)/\"\n",
+		"databases:\n  - name: reload-a\n    dsn: \"exporter@tcp(127.0.0.1:1)/\"\n    tls:\n      ca_file: /nonexistent/ca.pem\n",
+	} {
+		if err := os.WriteFile(filename, []byte(invalid), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		captureLog(t, r.reloadAndRecord)
+		if v := gaugeValue(t, lastReloadSuccessful); v != 0 {
+			t.Errorf("mysql_exporter_last_reload_successful = %v after an invalid config, want 0", v)
+		}
+		if got := live.snapshot(); len(got) != 2 || got["reload-a"].db != before["reload-a"].db || got["reload-b"].db != before["reload-b"].db {
+			t.Errorf("invalid config %q replaced the running databases: %v", invalid, got)
+		}
+	}
+	if n := len(r.current().Databases); n != 2 {
+		t.Errorf("running config has %d databases after invalid reloads, want 2", n)
+	}
+
+	// a is kept as is, b is removed and c added
+	if err := os.WriteFile(filename, []byte(`
+databases:
+  - name: reload-a
+    dsn: "exporter@tcp(127.0.0.1:1)/"
+  - name: reload-c
+    dsn: "exporter@tcp(127.0.0.1:1)/"
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	captureLog(t, r.reloadAndRecord)
+	if v := gaugeValue(t, lastReloadSuccessful); v != 1 {
+		t.Errorf("mysql_exporter_last_reload_successful = %v after a valid config, want 1", v)
+	}
+	if v := gaugeValue(t, lastReloadSuccessTimestamp); v == 0 {
+		t.Error("mysql_exporter_last_reload_success_timestamp_seconds was not set")
+	}
+	if v := gaugeValue(t, reloadsTotal); v != reloads+4 {
+		t.Errorf("mysql_exporter_reloads_total = %v, want %v", v, reloads+4)
+	}
+	got := live.snapshot()
+	if _, ok := got["reload-b"]; ok || len(got) != 2 {
+		t.Errorf("databases after reload = %v, want reload-a and reload-c", got)
+	}
+	if got["reload-a"].db != before["reload-a"].db {
+		t.Error("unchanged database reload-a was reopened")
+	}
+	if got["reload-c"].db == nil {
+		t.Error("added database reload-c was not opened")
+	}
+	if databases := r.current().Databases; len(databases) != 2 || databases[1].Name != "reload-c" {
+		t.Errorf("running config databases = %v, want reload-a and reload-c", databases)
+	}
+}
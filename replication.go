@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	groupReplicationMemberState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_group_replication_member_state",
+			Help: "State of each group replication member: 1=ONLINE, 2=RECOVERING, 3=UNREACHABLE, 4=ERROR, 5=OFFLINE, 0=other.",
+		},
+		labelNames("member_id", "member_host", "member_role"),
+	)
+	replicaSourceInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_slave_master_info",
+			Help: "The source (master) each replication channel of the replica replicates from, value is always 1.",
+		},
+		labelNames("channel", "master_host", "master_port"),
+	)
+	replicaSQLDelay = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_slave_sql_delay_seconds",
+			Help: "Configured delay of the replication channel (SOURCE_DELAY), subtract it from the observed lag of delayed replicas.",
+		},
+		labelNames("channel"),
+	)
+	replicaRelayLogApplyRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_slave_relay_log_apply_bytes_per_second",
+			Help: "Rate at which the SQL thread advanced in the relay log (Relay_Log_Pos) between the last two collections, in bytes per second.",
+		},
+		labelNames("channel"),
+	)
+	groupReplicationMembers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_group_replication_members",
+			Help: "Number of members in the replication group as seen by this server.",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(groupReplicationMemberState)
+	mustRegisterVec(groupReplicationMembers)
+	mustRegisterVec(replicaSourceInfo)
+	mustRegisterVec(replicaSQLDelay)
+	mustRegisterVec(replicaRelayLogApplyRate)
+}
+
+var groupReplicationStates = map[string]float64{
+	"ONLINE":      1,
+	"RECOVERING":  2,
+	"UNREACHABLE": 3,
+	"ERROR":       4,
+	"OFFLINE":     5,
+}
+
+// queryRowMaps runs query and returns each row as a map of lowercased column
+// name to value, for tables whose columns differ between server versions
+func queryRowMaps(db queryer, query string) ([]map[string]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []map[string]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			row[strings.ToLower(column)] = values[i].String
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// isSyntaxError reports whether err is MySQL's parse error, returned for
+// statements the server does not know yet or any more
+func isSyntaxError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1064
+}
+
+// queryRowMapsFallback runs the first of queries the server understands,
+// for statements renamed between server versions
+func queryRowMapsFallback(db queryer, queries ...string) ([]map[string]string, error) {
+	var err error
+	for _, query := range queries {
+		var rows []map[string]string
+		rows, err = queryRowMaps(db, query)
+		if !isSyntaxError(err) {
+			return rows, err
+		}
+	}
+	return nil, err
+}
+
+// queryReplicaStatus returns one row per replication channel, with the
+// MySQL 8.0.22+ column names. SHOW SLAVE STATUS was replaced by SHOW REPLICA
+// STATUS in 8.0.22, which renamed Master_* columns to Source_*.
+func queryReplicaStatus(db queryer) ([]map[string]string, error) {
+	rows, err := queryRowMapsFallback(db, "SHOW REPLICA STATUS", "SHOW SLAVE STATUS")
+	for _, row := range rows {
+		for column, value := range row {
+			if renamed := strings.Replace(column, "master", "source", 1); renamed != column {
+				row[renamed] = value
+			}
+		}
+	}
+	return rows, err
+}
+
+// relayLogPosition is where the SQL thread of a channel was in the relay log
+type relayLogPosition struct {
+	file string
+	pos  float64
+	at   time.Time
+}
+
+// Relay log positions seen at the previous collection, keyed by cloud_name
+// and channel
+var (
+	lastRelayLogPositionsMu sync.Mutex
+	lastRelayLogPositions   = make(map[string]map[string]relayLogPosition)
+)
+
+func collectReplicaSource(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	channels, err := queryReplicaStatus(db)
+	if err != nil {
+		log.Printf("database %s: Error reading replica status: %v", cloudName, err)
+		return
+	}
+	now := time.Now()
+
+	// Channels can be reset or repointed, and non-replicas export nothing
+	replicaSourceInfo.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	replicaSQLDelay.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+
+	lastRelayLogPositionsMu.Lock()
+	defer lastRelayLogPositionsMu.Unlock()
+	previous := lastRelayLogPositions[cloudName]
+	positions := make(map[string]relayLogPosition)
+
+	for _, channel := range channels {
+		name := channel["channel_name"]
+		labels := dbConfig.labelValues(name, channel["source_host"], channel["source_port"])
+		replicaSourceInfo.WithLabelValues(labels...).Set(1)
+
+		if delay, err := strconv.ParseFloat(channel["sql_delay"], 64); err == nil {
+			replicaSQLDelay.WithLabelValues(dbConfig.labelValues(name)...).Set(delay)
+		}
+
+		pos, err := strconv.ParseFloat(channel["relay_log_pos"], 64)
+		if err != nil {
+			continue
+		}
+		current := relayLogPosition{file: channel["relay_log_file"], pos: pos, at: now}
+		positions[name] = current
+
+		// After the relay log rotated the position restarts in the new file
+		// and the end of the previous file is unknown, so the rate is only
+		// updated at the next collection
+		last, ok := previous[name]
+		if !ok || last.file != current.file || current.pos < last.pos {
+			continue
+		}
+		if elapsed := current.at.Sub(last.at).Seconds(); elapsed > 0 {
+			replicaRelayLogApplyRate.WithLabelValues(dbConfig.labelValues(name)...).Set((current.pos - last.pos) / elapsed)
+		}
+	}
+
+	// Drop the rate of channels that are gone
+	for name := range previous {
+		if _, ok := positions[name]; !ok {
+			replicaRelayLogApplyRate.DeleteLabelValues(dbConfig.labelValues(name)...)
+		}
+	}
+	lastRelayLogPositions[cloudName] = positions
+}
+
+func collectGroupReplication(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	// MEMBER_ROLE only exists on MySQL 8.0+
+	members, err := queryRowMaps(db, "SELECT * FROM performance_schema.replication_group_members")
+	if err != nil {
+		if isMissingObjectError(err) {
+			logOnce("group-replication-missing:"+cloudName, "database %s: replication_group_members not available, skipping group replication", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing group replication query: %v", cloudName, err)
+		return
+	}
+	// Group replication is not running
+	if len(members) == 0 {
+		return
+	}
+
+	// Members come and go, so only the current ones are exported
+	groupReplicationMemberState.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for _, member := range members {
+		labels := dbConfig.labelValues(member["member_id"], member["member_host"], member["member_role"])
+		groupReplicationMemberState.WithLabelValues(labels...).Set(groupReplicationStates[member["member_state"]])
+	}
+	groupReplicationMembers.WithLabelValues(dbConfig.labelValues()...).Set(float64(len(members)))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// LabelRewriteConfig replaces the matches of Regex in the values of a
+// database or table label, e.g. to collapse per-tenant tables into one name
+type LabelRewriteConfig struct {
+	// Label is "database" or "table"
+	Label string `yaml:"label"`
+	Regex string `yaml:"regex"`
+	// Replacement may refer to submatches as $1, ${name}
+	Replacement string `yaml:"replacement"`
+}
+
+// Rewrite rules are compiled once, as they are applied to every table
+var (
+	rewriteRegexpsMu sync.Mutex
+	rewriteRegexps   = make(map[string]*regexp.Regexp)
+)
+
+func (c LabelRewriteConfig) regexp() *regexp.Regexp {
+	rewriteRegexpsMu.Lock()
+	defer rewriteRegexpsMu.Unlock()
+	re, ok := rewriteRegexps[c.Regex]
+	if !ok {
+		re = regexp.MustCompile(c.Regex)
+		rewriteRegexps[c.Regex] = re
+	}
+	return re
+}
+
+// validateLabelRewrites checks the label and regex of every rewrite rule
+func validateLabelRewrites(rewrites []LabelRewriteConfig) error {
+	for _, r := range rewrites {
+		if r.Label != "database" && r.Label != "table" {
+			return fmt.Errorf("label_rewrites: label %q must be database or table", r.Label)
+		}
+		if _, err := regexp.Compile(r.Regex); err != nil {
+			return fmt.Errorf("label_rewrites: %v", err)
+		}
+	}
+	return nil
+}
+
+// rewriteLabel applies the rewrite rules of label to value, in order
+func (c DatabaseConfig) rewriteLabel(label, value string) string {
+	for _, r := range c.LabelRewrites {
+		if r.Label == label {
+			value = r.regexp().ReplaceAllString(value, r.Replacement)
+		}
+	}
+	return value
+}
+
+// rewriteTable returns the database and table labels of a table
+func (c DatabaseConfig) rewriteTable(dbName, tableName string) (string, string) {
+	return c.rewriteLabel("database", dbName), c.rewriteLabel("table", tableName)
+}
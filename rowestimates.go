@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var tableRowEstimateError = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_table_row_estimate_error_ratio",
+		Help: "|table_rows - COUNT(*)| / COUNT(*) of the table, how far the information_schema.tables row estimate is from the exact count.",
+	},
+	labelNames("database", "table"),
+)
+
+func init() {
+	mustRegisterVec(tableRowEstimateError)
+}
+
+// Most tables row_estimates counts exactly, as each count scans the table
+const maxRowEstimateTables = 10
+
+// RowEstimatesConfig compares the row estimate of a few tables with their
+// exact row count
+type RowEstimatesConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// Tables are the tables to count, as schema.table
+	Tables []string `yaml:"tables"`
+	// Timeout cancels each exact count after this long. Defaults to 30s.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c RowEstimatesConfig) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return 30 * time.Second
+	}
+	return c.Timeout
+}
+
+// validate requires an explicit, short table list when enabled
+func (c RowEstimatesConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Tables) == 0 {
+		return errors.New("row_estimates: tables is required")
+	}
+	if len(c.Tables) > maxRowEstimateTables {
+		return fmt.Errorf("row_estimates: at most %d tables can be listed", maxRowEstimateTables)
+	}
+	for _, table := range c.Tables {
+		if schema, name, ok := strings.Cut(table, "."); !ok || schema == "" || name == "" {
+			return fmt.Errorf("row_estimates: table %q is not schema.table", table)
+		}
+	}
+	return nil
+}
+
+func collectRowEstimates(db queryer, dbConfig DatabaseConfig) {
+	for _, table := range dbConfig.RowEstimates.Tables {
+		collectRowEstimate(db, dbConfig, table)
+	}
+}
+
+// collectRowEstimate reads the estimate before the exact count, so rows
+// written in between add to the error of busy tables
+func collectRowEstimate(db queryer, dbConfig DatabaseConfig, table string) {
+	cloudName := dbConfig.Name
+	schema, name, _ := strings.Cut(table, ".")
+	labels := dbConfig.labelValues(schema, name)
+
+	var estimate sql.NullFloat64
+	err := db.QueryRow("SELECT table_rows FROM information_schema.tables WHERE table_schema = ? AND table_name = ?", schema, name).Scan(&estimate)
+	if err == sql.ErrNoRows {
+		logOnce("row-estimates-missing:"+cloudName+":"+table, "database %s: table %s not found, skipping its row estimate", cloudName, table)
+		tableRowEstimateError.DeleteLabelValues(labels...)
+		return
+	}
+	if err != nil {
+		log.Printf("database %s: Error reading row estimate of %s: %v", cloudName, table, err)
+		return
+	}
+
+	timeout := dbConfig.RowEstimates.timeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// MAX_EXECUTION_TIME stops the scan on the server even if the cancelled
+	// connection is not noticed
+	var exact float64
+	query := fmt.Sprintf("SELECT /*+ MAX_EXECUTION_TIME(%d) */ COUNT(*) FROM %s", timeout.Milliseconds(), quoteIdentifier(table))
+	if err := db.QueryRowContext(ctx, query).Scan(&exact); err != nil {
+		log.Printf("database %s: Error counting rows of %s: %v", cloudName, table, err)
+		return
+	}
+
+	// The ratio is undefined for empty tables
+	if exact == 0 {
+		tableRowEstimateError.DeleteLabelValues(labels...)
+		return
+	}
+	tableRowEstimateError.WithLabelValues(labels...).Set(math.Abs(estimate.Float64-exact) / exact)
+}
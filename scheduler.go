@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	scrapeInterval = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_scrape_interval_seconds",
+			Help: "Configured interval between runs of the collector, in seconds.",
+		},
+		labelNames("collector"),
+	)
+	lastScrapeTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_last_scrape_timestamp_seconds",
+			Help: "Unix timestamp of the end of the collector's last run.",
+		},
+		labelNames("collector"),
+	)
+	scrapeLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_scrape_lag_seconds",
+			Help: "Delay between the scheduled and the actual start of the collector's last run, in seconds.",
+		},
+		labelNames("collector"),
+	)
+	scrapeDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_scrape_duration_seconds",
+			Help: "Duration of the collector's last run, in seconds.",
+		},
+		labelNames("collector"),
+	)
+)
+
+func init() {
+	mustRegisterVec(scrapeInterval)
+	mustRegisterVec(lastScrapeTimestamp)
+	mustRegisterVec(scrapeLag)
+	mustRegisterVec(scrapeDuration)
+}
+
+// Collector tiers, from most to least frequently run
+const (
+	tierFast   = "fast"
+	tierNormal = "normal"
+	tierSlow   = "slow"
+)
+
+// TierConfig sets how often the collectors of each tier run
+type TierConfig struct {
+	Fast   time.Duration `yaml:"fast"`
+	Normal time.Duration `yaml:"normal"`
+	Slow   time.Duration `yaml:"slow"`
+}
+
+func (c TierConfig) interval(tier string) time.Duration {
+	switch tier {
+	case tierFast:
+		if c.Fast > 0 {
+			return c.Fast
+		}
+		return time.Minute
+	case tierNormal:
+		if c.Normal > 0 {
+			return c.Normal
+		}
+		return 5 * time.Minute
+	default:
+		if c.Slow > 0 {
+			return c.Slow
+		}
+		return 55 * time.Minute
+	}
+}
+
+// collector is a named unit of collection that runs on a tier
+type collector struct {
+	name string
+	// tier is the default tier, overridable with collector_tiers
+	tier string
+	// config returns the collector's settings for optional collectors, and
+	// is nil for collectors that always run
+	config func(dbConfig DatabaseConfig) CollectorConfig
+	// primaryOnly collectors need privileges or state only a primary has and
+	// are skipped for databases marked replica_only
+	primaryOnly bool
+	// verbose optional collectors also run while the database has the
+	// verbose profile, set through /admin/profile
+	verbose bool
+	// after names the collectors this one depends on. It always runs in the
+	// same group as them and after them, and must be listed after them.
+	after   []string
+	collect func(db queryer, dbConfig DatabaseConfig)
+	// fromSnapshot replaces collect for collectors reading the group's
+	// shared snapshot of the server status and variables
+	fromSnapshot func(s *snapshot)
+}
+
+// run runs the collector within the group sharing s and records its
+// duration and end time. The first collector reading the snapshot is charged
+// for querying it.
+func (c collector) run(s *snapshot) {
+	labels := s.dbConfig.labelValues(c.name)
+	start := time.Now()
+
+	timeout := c.timeout(s.dbConfig)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	s.ctx = ctx
+	if c.fromSnapshot != nil {
+		c.fromSnapshot(s)
+	} else {
+		c.collect(s.queryer(), s.dbConfig)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Printf("database %s: WARN collector %s exceeded its timeout of %s", s.dbConfig.Name, c.name, timeout)
+	}
+	scrapeDuration.WithLabelValues(labels...).Set(time.Since(start).Seconds())
+	lastScrapeTimestamp.WithLabelValues(labels...).SetToCurrentTime()
+}
+
+var mysqlCollectors = []collector{
+	{name: "global_status", tier: tierFast, fromSnapshot: collectGlobalStatus},
+	{name: "server_identity", tier: tierFast, collect: collectServerIdentity},
+	{name: "server_settings", tier: tierFast, fromSnapshot: collectServerSettings},
+	{name: "replica_source", tier: tierNormal, collect: collectReplicaSource},
+	{name: "binlog", tier: tierNormal, fromSnapshot: collectBinlog, primaryOnly: true},
+	{name: "group_replication", tier: tierFast, collect: collectGroupReplication},
+	{name: "locks", tier: tierFast, fromSnapshot: collectLocks},
+	{name: "metadata_locks", tier: tierFast, collect: collectMetadataLocks},
+	{name: "buffer_pool", tier: tierFast, fromSnapshot: collectBufferPool},
+	{name: "transactions", tier: tierFast, collect: collectTransactions},
+	{name: "tmp_tables", after: []string{"global_status"}, fromSnapshot: collectTmpTables},
+	{name: "max_used_connections", after: []string{"global_status"}, fromSnapshot: collectMaxUsedConnections},
+	{name: "conn_count", tier: tierNormal, collect: collectConnCount},
+	{name: "database_connections", tier: tierNormal, collect: collectDatabaseConnections},
+	{name: "ssl", tier: tierNormal, fromSnapshot: collectSSL},
+	{name: "statement_stats", tier: tierNormal, collect: collectStatementStats},
+	{name: "connections_by_host", tier: tierNormal, collect: collectConnectionsByHost},
+	{name: "processlist", tier: tierSlow, collect: collectProcessList},
+	{name: "tables", tier: tierSlow, fromSnapshot: collectTables},
+	{name: "undo_tablespaces", tier: tierSlow, collect: collectUndoTablespaces},
+	{name: "plugins", tier: tierSlow, collect: collectPlugins},
+	{name: "user_accounts", tier: tierSlow, collect: collectUserAccounts, primaryOnly: true},
+	{name: "schema_grants", tier: tierSlow, collect: collectSchemaGrants, primaryOnly: true},
+	{name: "open_temp_tables", tier: tierNormal, collect: collectOpenTempTables},
+	{name: "adaptive_hash_index", tier: tierNormal, fromSnapshot: collectAdaptiveHashIndex},
+	{name: "events", tier: tierSlow, collect: collectEvents},
+	{
+		name: "heartbeat", tier: tierFast, collect: collectHeartbeat,
+		config: func(c DatabaseConfig) CollectorConfig { return c.Heartbeat.CollectorConfig },
+	},
+	{
+		name: "charset", tier: tierSlow, fromSnapshot: inSnapshot(collectCharset), verbose: true,
+		config: func(c DatabaseConfig) CollectorConfig { return c.Charset },
+	},
+	{
+		name: "foreign_keys", tier: tierSlow, fromSnapshot: inSnapshot(collectForeignKeys), verbose: true,
+		config: func(c DatabaseConfig) CollectorConfig { return c.ForeignKeys },
+	},
+	{
+		name: "partitions", tier: tierSlow, fromSnapshot: inSnapshot(collectPartitions), verbose: true,
+		config: func(c DatabaseConfig) CollectorConfig { return c.Partitions.CollectorConfig },
+	},
+	{
+		name: "tablespaces", tier: tierSlow, collect: collectTablespaces, verbose: true,
+		config: func(c DatabaseConfig) CollectorConfig { return c.Tablespaces },
+	},
+	{
+		name: "stored_programs", tier: tierSlow, fromSnapshot: inSnapshot(collectStoredPrograms), verbose: true,
+		config: func(c DatabaseConfig) CollectorConfig { return c.StoredPrograms },
+	},
+	{
+		name: "accounts", tier: tierNormal, collect: collectAccounts, verbose: true,
+		config: func(c DatabaseConfig) CollectorConfig { return c.Accounts.CollectorConfig },
+	},
+	{
+		name: "thread_cpu", tier: tierNormal, collect: collectThreadCPU, verbose: true,
+		config: func(c DatabaseConfig) CollectorConfig { return c.ThreadCPU.CollectorConfig },
+	},
+	{
+		name: "slow_statements", tier: tierNormal, collect: collectSlowStatements, verbose: true,
+		config: func(c DatabaseConfig) CollectorConfig { return c.SlowStatements.CollectorConfig },
+	},
+	{
+		name: "table_io", tier: tierSlow, collect: collectTableIO, verbose: true,
+		config: func(c DatabaseConfig) CollectorConfig { return c.TableIO.CollectorConfig },
+	},
+	{
+		name: "index_sizes", tier: tierSlow, fromSnapshot: inSnapshot(collectIndexSizes),
+		config: func(c DatabaseConfig) CollectorConfig { return c.IndexSizes.CollectorConfig },
+	},
+	{
+		name: "innodb_metrics", tier: tierFast, collect: collectInnodbMetrics,
+		config: func(c DatabaseConfig) CollectorConfig { return c.InnodbMetrics.CollectorConfig },
+	},
+	{
+		name: "row_estimates", tier: tierSlow, collect: collectRowEstimates,
+		config: func(c DatabaseConfig) CollectorConfig { return c.RowEstimates.CollectorConfig },
+	},
+	{
+		name: "table_check", tier: tierSlow, collect: collectTableCheck,
+		config: func(c DatabaseConfig) CollectorConfig { return c.TableCheck.CollectorConfig },
+	},
+	{
+		name: "watched_tables", tier: tierNormal, collect: collectWatchedTables,
+		config: func(c DatabaseConfig) CollectorConfig {
+			return CollectorConfig{Enabled: len(c.WatchedTables) > 0}
+		},
+	},
+}
+
+var proxysqlCollectors = []collector{
+	{
+		name: "proxysql", tier: tierFast, collect: collectProxySQL,
+		// Always enabled for type: proxysql, only the interval is configurable
+		config: func(c DatabaseConfig) CollectorConfig {
+			return CollectorConfig{Enabled: true, Interval: c.ProxySQL.Interval}
+		},
+	},
+}
+
+var vitessCollectors = []collector{
+	{
+		name: "vitess", tier: tierFast, collect: collectVitess,
+		// Always enabled for type: vitess, only the interval is configurable
+		config: func(c DatabaseConfig) CollectorConfig {
+			return CollectorConfig{Enabled: true, Interval: c.Vitess.Interval}
+		},
+	},
+}
+
+// tierOf returns the tier a collector runs on for a database. Collectors
+// with dependencies run on the tier of their first dependency.
+func (c collector) tierOf(dbConfig DatabaseConfig) string {
+	if len(c.after) > 0 {
+		for _, dep := range mysqlCollectors {
+			if dep.name == c.after[0] {
+				return dep.tierOf(dbConfig)
+			}
+		}
+	}
+	if tier, ok := dbConfig.CollectorTiers[c.name]; ok {
+		return tier
+	}
+	return c.tier
+}
+
+// interval returns how often the collector runs for a database
+func (c collector) interval(dbConfig DatabaseConfig) time.Duration {
+	if c.config != nil {
+		if cfg := c.config(dbConfig); cfg.Interval > 0 {
+			return cfg.Interval
+		}
+	}
+	return dbConfig.Tiers.interval(c.tierOf(dbConfig))
+}
+
+// timeout returns how long the queries of one run of the collector may take,
+// set with timeouts and defaulting to the collector's interval
+func (c collector) timeout(dbConfig DatabaseConfig) time.Duration {
+	if timeout, ok := dbConfig.Timeouts[c.name]; ok {
+		return timeout
+	}
+	return c.interval(dbConfig)
+}
+
+// isKnownCollector reports whether name is the name of any collector
+func isKnownCollector(name string) bool {
+	for _, c := range append(append(mysqlCollectors, proxysqlCollectors...), vitessCollectors...) {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// disabled reports whether the collector is listed in disable_collectors
+func (c collector) disabled(dbConfig DatabaseConfig) bool {
+	for _, name := range dbConfig.DisableCollectors {
+		if name == c.name {
+			return true
+		}
+	}
+	return false
+}
+
+// enabled reports whether the collector runs for the database, given its
+// current profile
+func (c collector) enabled(dbConfig DatabaseConfig) bool {
+	if !c.schedulable(dbConfig) {
+		return false
+	}
+	if c.config == nil || c.config(dbConfig).Enabled {
+		return true
+	}
+	return c.verbose && profiles.isVerbose(dbConfig.Name)
+}
+
+// schedulable reports whether the collector can run for the database under
+// any profile
+func (c collector) schedulable(dbConfig DatabaseConfig) bool {
+	if c.disabled(dbConfig) || (c.primaryOnly && dbConfig.ReplicaOnly) {
+		return false
+	}
+	return c.config == nil || c.config(dbConfig).Enabled || c.verbose
+}
+
+// collectorsFor returns the collectors for the type of the database.
+// ProxySQL and VTGate speak the MySQL protocol but have none of the schemas
+// the MySQL collectors query, so they only run their own collector.
+func collectorsFor(dbConfig DatabaseConfig) []collector {
+	switch dbConfig.Type {
+	case "proxysql":
+		return proxysqlCollectors
+	case "vitess":
+		return vitessCollectors
+	}
+	return mysqlCollectors
+}
+
+// validateCollectors checks that collector_tiers, disable_collectors and
+// timeouts only name known collectors and tiers
+func validateCollectors(dbConfig DatabaseConfig) error {
+	for _, name := range dbConfig.DisableCollectors {
+		if !isKnownCollector(name) {
+			return fmt.Errorf("disable_collectors: unknown collector %q", name)
+		}
+	}
+	for name, tier := range dbConfig.CollectorTiers {
+		if !isKnownCollector(name) {
+			return fmt.Errorf("collector_tiers: unknown collector %q", name)
+		}
+		for _, c := range mysqlCollectors {
+			if c.name == name && len(c.after) > 0 {
+				return fmt.Errorf("collector_tiers: collector %q runs on the tier of %s", name, c.after[0])
+			}
+		}
+		if tier != tierFast && tier != tierNormal && tier != tierSlow {
+			return fmt.Errorf("collector_tiers: unknown tier %q for collector %q", tier, name)
+		}
+	}
+	for name, timeout := range dbConfig.Timeouts {
+		if !isKnownCollector(name) {
+			return fmt.Errorf("timeouts: unknown collector %q", name)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("timeouts: timeout of collector %q must be positive", name)
+		}
+	}
+	return nil
+}
+
+// schedule starts one goroutine per tier running the enabled collectors of
+// that tier in order, plus one per collector with its own interval. They
+// stop when done is closed.
+func schedule(db *sql.DB, dbConfig DatabaseConfig, collectors []collector, done <-chan struct{}) {
+	tiers := make(map[string][]collector)
+	var tierOrder []string
+
+	for _, c := range collectors {
+		if !c.schedulable(dbConfig) {
+			continue
+		}
+		if c.config != nil {
+			if cfg := c.config(dbConfig); cfg.Interval > 0 {
+				scrapeInterval.WithLabelValues(dbConfig.labelValues(c.name)...).Set(cfg.Interval.Seconds())
+				go runCollectors(db, dbConfig, cfg.Interval, []collector{c}, done)
+				continue
+			}
+		}
+
+		tier := c.tierOf(dbConfig)
+		scrapeInterval.WithLabelValues(dbConfig.labelValues(c.name)...).Set(dbConfig.Tiers.interval(tier).Seconds())
+		if _, ok := tiers[tier]; !ok {
+			tierOrder = append(tierOrder, tier)
+		}
+		tiers[tier] = append(tiers[tier], c)
+	}
+
+	for _, tier := range tierOrder {
+		go runCollectors(db, dbConfig, dbConfig.Tiers.interval(tier), tiers[tier], done)
+	}
+}
+
+// runCollectors runs collectors one after another every interval until done
+// is closed. A collector's lag includes the time spent by the collectors
+// before it.
+func runCollectors(db *sql.DB, dbConfig DatabaseConfig, interval time.Duration, collectors []collector, done <-chan struct{}) {
+	runEvery(dbConfig.Name, interval, done, func(scheduled time.Time) {
+		s := newSnapshot(db, dbConfig)
+		for _, c := range collectors {
+			if !c.enabled(dbConfig) {
+				continue
+			}
+			scrapeLag.WithLabelValues(dbConfig.labelValues(c.name)...).Set(time.Since(scheduled).Seconds())
+			c.run(s)
+		}
+		s.close()
+	})
+}
+
+// collectOnce runs every enabled collector of the database once
+func collectOnce(db *sql.DB, dbConfig DatabaseConfig) {
+	s := newSnapshot(db, dbConfig)
+	defer s.close()
+	for _, c := range collectorsFor(dbConfig) {
+		if !c.enabled(dbConfig) {
+			continue
+		}
+		c.run(s)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func findCollector(t *testing.T, name string) collector {
+	t.Helper()
+	for _, c := range mysqlCollectors {
+		if c.name == name {
+			return c
+		}
+	}
+	t.Fatalf("no collector %q", name)
+	return collector{}
+}
+
+func TestReplicaOnlySkipsPrimaryOnlyCollectors(t *testing.T) {
+	replica := DatabaseConfig{Name: "replica", ReplicaOnly: true}
+	primary := DatabaseConfig{Name: "primary"}
+
+	for _, name := range []string{"binlog", "user_accounts", "schema_grants"} {
+		c := findCollector(t, name)
+		if !c.primaryOnly {
+			t.Errorf("collector %s is not primaryOnly", name)
+		}
+		if c.schedulable(replica) {
+			t.Errorf("collector %s is scheduled for a replica_only database", name)
+		}
+		if !c.schedulable(primary) {
+			t.Errorf("collector %s is not scheduled for a primary", name)
+		}
+	}
+
+	// Counter-based collectors keep running on replicas
+	for _, name := range []string{"global_status", "replica_source", "locks"} {
+		if !findCollector(t, name).schedulable(replica) {
+			t.Errorf("collector %s is not scheduled for a replica_only database", name)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tableForeignKeys = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_table_foreign_keys",
+			Help: "Number of foreign keys defined on the table.",
+		},
+		labelNames("database", "table"),
+	)
+	tableReferencedBy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_table_referenced_by",
+			Help: "Number of foreign keys in other tables referencing the table.",
+		},
+		labelNames("database", "table"),
+	)
+	schemaTriggers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_schema_triggers",
+			Help: "Number of triggers defined in the schema.",
+		},
+		labelNames("database"),
+	)
+	schemaRoutines = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_schema_routines",
+			Help: "Number of stored routines in the schema, by type (procedure or function).",
+		},
+		labelNames("database", "type"),
+	)
+	schemaEvents = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_schema_events",
+			Help: "Number of scheduled events defined in the schema.",
+		},
+		labelNames("database"),
+	)
+)
+
+func init() {
+	mustRegisterVec(tableForeignKeys)
+	mustRegisterVec(tableReferencedBy)
+	mustRegisterVec(schemaTriggers)
+	mustRegisterVec(schemaRoutines)
+	mustRegisterVec(schemaEvents)
+}
+
+// querySchemaCounts runs a query returning (schema, count) rows and sets
+// gauge for every schema allowed by the database filters
+func querySchemaCounts(db queryer, dbConfig DatabaseConfig, gauge *prometheus.GaugeVec, name string, query string) {
+	cloudName := dbConfig.Name
+
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Printf("database %s: Error executing %s query: %v", cloudName, name, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dbName string
+		var count int
+
+		if err := rows.Scan(&dbName, &count); err != nil {
+			log.Printf("database %s: Error scanning %s row: %v", cloudName, name, err)
+			continue
+		}
+		if !dbConfig.schemaAllowed(dbName) {
+			continue
+		}
+
+		gauge.WithLabelValues(dbConfig.labelValues(dbName)...).Set(float64(count))
+	}
+}
+
+// queryTableCounts runs a query returning (schema, table, count) rows and
+// sets gauge for every table in a schema allowed by the database filters
+func queryTableCounts(db queryer, dbConfig DatabaseConfig, gauge *prometheus.GaugeVec, name string, query string) {
+	cloudName := dbConfig.Name
+
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Printf("database %s: Error executing %s query: %v", cloudName, name, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dbName, tableName string
+		var count int
+
+		if err := rows.Scan(&dbName, &tableName, &count); err != nil {
+			log.Printf("database %s: Error scanning %s row: %v", cloudName, name, err)
+			continue
+		}
+		if !dbConfig.schemaAllowed(dbName) {
+			continue
+		}
+
+		gauge.WithLabelValues(dbConfig.labelValues(dbName, tableName)...).Set(float64(count))
+	}
+}
+
+func collectForeignKeys(db queryer, dbConfig DatabaseConfig) {
+	queryTableCounts(db, dbConfig, tableForeignKeys, "foreign key", `
+		SELECT constraint_schema, table_name, COUNT(*)
+		FROM information_schema.referential_constraints
+		GROUP BY constraint_schema, table_name
+	`)
+	queryTableCounts(db, dbConfig, tableReferencedBy, "referenced by", `
+		SELECT unique_constraint_schema, referenced_table_name, COUNT(*)
+		FROM information_schema.referential_constraints
+		GROUP BY unique_constraint_schema, referenced_table_name
+	`)
+}
+
+func collectStoredPrograms(db queryer, dbConfig DatabaseConfig) {
+	querySchemaCounts(db, dbConfig, schemaTriggers, "trigger", `
+		SELECT trigger_schema, COUNT(*)
+		FROM information_schema.triggers
+		GROUP BY trigger_schema
+	`)
+	// The second column is the routine type rather than a table name
+	queryTableCounts(db, dbConfig, schemaRoutines, "routine", `
+		SELECT routine_schema, LOWER(routine_type), COUNT(*)
+		FROM information_schema.routines
+		GROUP BY routine_schema, routine_type
+	`)
+	querySchemaCounts(db, dbConfig, schemaEvents, "event", `
+		SELECT event_schema, COUNT(*)
+		FROM information_schema.events
+		GROUP BY event_schema
+	`)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	transactionIsolationInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_transaction_isolation_info",
+			Help: "The server's default transaction isolation level, value is always 1.",
+		},
+		labelNames("level"),
+	)
+	readOnly = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_read_only",
+			Help: "Whether the server is read-only (read_only or super_read_only), 1 for read-only and 0 otherwise.",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(transactionIsolationInfo)
+	mustRegisterVec(readOnly)
+}
+
+// isUnknownVariableError reports whether err is MySQL's "unknown system
+// variable" error.
+func isUnknownVariableError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1193
+}
+
+// collectServerSettings reads the settings that change on failover. Unlike
+// the server identity they are not cached, as they are cheap to read.
+func collectServerSettings(s *snapshot) {
+	db, dbConfig := s.queryer(), s.dbConfig
+	cloudName := dbConfig.Name
+
+	// transaction_isolation replaced tx_isolation in MySQL 5.7.20, and
+	// super_read_only=ON always forces read_only=ON
+	var level string
+	var readOnlyValue int
+	var err error
+	if s.batched() {
+		variables, _ := s.globalVariables()
+		level = variables["transaction_isolation"]
+		if level == "" {
+			level = variables["tx_isolation"]
+		}
+		if variables["read_only"] == "ON" {
+			readOnlyValue = 1
+		}
+	} else {
+		err = db.QueryRow("SELECT @@GLOBAL.transaction_isolation, @@GLOBAL.read_only").Scan(&level, &readOnlyValue)
+		if isUnknownVariableError(err) {
+			err = db.QueryRow("SELECT @@GLOBAL.tx_isolation, @@GLOBAL.read_only").Scan(&level, &readOnlyValue)
+		}
+	}
+	if err != nil {
+		log.Printf("database %s: Error reading server settings: %v", cloudName, err)
+		return
+	}
+
+	transactionIsolationInfo.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	transactionIsolationInfo.WithLabelValues(dbConfig.labelValues(level)...).Set(1)
+	readOnly.WithLabelValues(dbConfig.labelValues()...).Set(float64(readOnlyValue))
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	slowLogQueries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_slow_log_queries_total",
+			Help: "Number of queries written to the slow query log since the exporter started tailing it, by normalized digest.",
+		},
+		labelNames("digest"),
+	)
+	slowLogQueryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mysql_slow_log_query_duration_seconds",
+			Help:    "Query_time of the queries written to the slow query log.",
+			Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 300},
+		},
+		labelNames(),
+	)
+	slowLogLockTime = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_slow_log_lock_seconds_total",
+			Help: "Sum of the Lock_time of the queries written to the slow query log.",
+		},
+		labelNames(),
+	)
+	slowLogRowsExamined = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_slow_log_rows_examined_total",
+			Help: "Sum of the Rows_examined of the queries written to the slow query log.",
+		},
+		labelNames(),
+	)
+	slowLogRowsSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_slow_log_rows_sent_total",
+			Help: "Sum of the Rows_sent of the queries written to the slow query log.",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(slowLogQueries)
+	mustRegisterVec(slowLogQueryDuration)
+	mustRegisterVec(slowLogLockTime)
+	mustRegisterVec(slowLogRowsExamined)
+	mustRegisterVec(slowLogRowsSent)
+}
+
+// Parsing is bounded per database: each poll reads at most
+// slowLogMaxBytesPerPoll, only the first slowLogMaxQueryLength bytes of a
+// query are normalized, and queries beyond the first slowLogMaxDigests
+// distinct digests are counted under digest "other".
+const (
+	slowLogPollInterval    = time.Second
+	slowLogMaxBytesPerPoll = 4 << 20
+	slowLogMaxQueryLength  = 4096
+	slowLogMaxDigests      = 100
+	slowLogDigestLength    = 120
+)
+
+var (
+	slowLogStrings    = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"`)
+	slowLogNumbers    = regexp.MustCompile(`\b-?\d+(?:\.\d+)?\b`)
+	slowLogLists      = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	slowLogWhitespace = regexp.MustCompile(`\s+`)
+)
+
+// normalizeQuery replaces the literals of a query with ? and truncates it,
+// so queries differing only in their values share a digest
+func normalizeQuery(query string) string {
+	query = slowLogStrings.ReplaceAllString(query, "?")
+	query = slowLogNumbers.ReplaceAllString(query, "?")
+	query = slowLogLists.ReplaceAllString(query, "(...)")
+	query = slowLogWhitespace.ReplaceAllString(query, " ")
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	if len(query) > slowLogDigestLength {
+		query = query[:slowLogDigestLength]
+	}
+	return query
+}
+
+// slowLogEntry is a slow query log block being read
+type slowLogEntry struct {
+	queryTime, lockTime, rowsSent, rowsExamined float64
+	query                                       strings.Builder
+}
+
+// slowLogParser turns the lines of a slow query log into metrics
+type slowLogParser struct {
+	dbConfig DatabaseConfig
+	entry    *slowLogEntry
+	digests  map[string]bool
+}
+
+func (p *slowLogParser) feed(line string) {
+	switch {
+	case strings.HasPrefix(line, "# Time:"), strings.HasPrefix(line, "# User@Host:"):
+		p.flush()
+	case strings.HasPrefix(line, "# Query_time:"):
+		// Blocks logged in the same second as the previous one have no
+		// # Time line
+		p.flush()
+		p.entry = parseSlowLogStats(line)
+	case strings.HasPrefix(line, "#"):
+		// Other headers, such as the extra ones of Percona Server and MariaDB
+	case p.entry == nil:
+		// Server start banners and queries whose header was not read
+	case strings.HasPrefix(line, "SET timestamp="), strings.HasPrefix(line, "use "):
+	default:
+		if remaining := slowLogMaxQueryLength - p.entry.query.Len(); remaining > 0 {
+			if len(line) > remaining {
+				line = line[:remaining]
+			}
+			p.entry.query.WriteString(line)
+			p.entry.query.WriteByte(' ')
+		}
+	}
+}
+
+// parseSlowLogStats reads a line such as
+// "# Query_time: 2.000154  Lock_time: 0.000000 Rows_sent: 1  Rows_examined: 0"
+func parseSlowLogStats(line string) *slowLogEntry {
+	entry := &slowLogEntry{}
+	fields := strings.Fields(strings.TrimPrefix(line, "#"))
+	for i := 0; i+1 < len(fields); i += 2 {
+		value, err := strconv.ParseFloat(fields[i+1], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[i] {
+		case "Query_time:":
+			entry.queryTime = value
+		case "Lock_time:":
+			entry.lockTime = value
+		case "Rows_sent:":
+			entry.rowsSent = value
+		case "Rows_examined:":
+			entry.rowsExamined = value
+		}
+	}
+	return entry
+}
+
+// flush exports the block being read, if any
+func (p *slowLogParser) flush() {
+	entry := p.entry
+	if entry == nil {
+		return
+	}
+	p.entry = nil
+
+	digest := normalizeQuery(entry.query.String())
+	if !p.digests[digest] {
+		if len(p.digests) >= slowLogMaxDigests {
+			digest = "other"
+		} else {
+			p.digests[digest] = true
+		}
+	}
+
+	labels := p.dbConfig.labelValues()
+	slowLogQueries.WithLabelValues(p.dbConfig.labelValues(digest)...).Inc()
+	slowLogQueryDuration.WithLabelValues(labels...).Observe(entry.queryTime)
+	slowLogLockTime.WithLabelValues(labels...).Add(entry.lockTime)
+	slowLogRowsExamined.WithLabelValues(labels...).Add(entry.rowsExamined)
+	slowLogRowsSent.WithLabelValues(labels...).Add(entry.rowsSent)
+}
+
+// slowLogTail follows a slow query log file across rotations
+type slowLogTail struct {
+	path    string
+	parser  *slowLogParser
+	file    *os.File
+	offset  int64
+	partial []byte
+	// rotated is set once the first file was read, as later files are
+	// read from their start rather than their end
+	rotated bool
+}
+
+// tailSlowLog exports the queries appended to the database's slow query log
+// until done is closed. Queries logged before the exporter started are not
+// counted.
+func tailSlowLog(dbConfig DatabaseConfig, done <-chan struct{}) {
+	t := &slowLogTail{
+		path:   dbConfig.SlowLogFile,
+		parser: &slowLogParser{dbConfig: dbConfig, digests: make(map[string]bool)},
+	}
+	for {
+		t.poll()
+		if !sleep(slowLogPollInterval, done) {
+			if t.file != nil {
+				t.file.Close()
+			}
+			return
+		}
+	}
+}
+
+func (t *slowLogTail) poll() {
+	cloudName := t.parser.dbConfig.Name
+
+	if t.file == nil && !t.open() {
+		return
+	}
+
+	read := t.read()
+	if read > 0 {
+		return
+	}
+	// Nothing new: the block being read is complete, and the file may have
+	// been rotated or truncated
+	t.parser.flush()
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return
+	}
+	current, err := t.file.Stat()
+	if err != nil || !os.SameFile(info, current) {
+		log.Printf("database %s: slow query log %s was rotated, reopening", cloudName, t.path)
+		t.file.Close()
+		t.file = nil
+		t.open()
+		return
+	}
+	if info.Size() < t.offset {
+		log.Printf("database %s: slow query log %s was truncated, reading from the start", cloudName, t.path)
+		if _, err := t.file.Seek(0, io.SeekStart); err == nil {
+			t.offset = 0
+			t.partial = nil
+		}
+	}
+}
+
+// open opens the log file, at its end the first time and at its start
+// after a rotation
+func (t *slowLogTail) open() bool {
+	cloudName := t.parser.dbConfig.Name
+
+	file, err := os.Open(t.path)
+	if err != nil {
+		logOnce("slow-log-open:"+cloudName, "database %s: Error opening slow query log: %v", cloudName, err)
+		return false
+	}
+	whence := io.SeekStart
+	if !t.rotated {
+		whence = io.SeekEnd
+	}
+	offset, err := file.Seek(0, whence)
+	if err != nil {
+		log.Printf("database %s: Error seeking slow query log %s: %v", cloudName, t.path, err)
+		file.Close()
+		return false
+	}
+	t.file, t.offset, t.partial, t.rotated = file, offset, nil, true
+	return true
+}
+
+// read feeds the complete lines appended since the last read to the parser,
+// returning the number of bytes read
+func (t *slowLogTail) read() int {
+	buf := make([]byte, 64<<10)
+	total := 0
+	for total < slowLogMaxBytesPerPoll {
+		n, err := t.file.Read(buf)
+		total += n
+		t.offset += int64(n)
+
+		data := append(t.partial, buf[:n]...)
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			t.parser.feed(strings.TrimRight(string(data[:i]), "\r"))
+			data = data[i+1:]
+		}
+		// A line longer than a whole poll is dropped rather than buffered
+		if len(data) > slowLogMaxBytesPerPoll {
+			data = nil
+		}
+		t.partial = append([]byte(nil), data...)
+
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("database %s: Error reading slow query log %s: %v", t.parser.dbConfig.Name, t.path, err)
+			}
+			break
+		}
+	}
+	return total
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log"
+	"sync"
+)
+
+// snapshot caches the raw SHOW GLOBAL STATUS and SHOW GLOBAL VARIABLES of a
+// database for one run of a group of collectors. Collectors reading it see
+// the same values, so metrics derived from both a status and a variable are
+// consistent with the metrics exported from the status alone.
+// With consistent_snapshot it also holds the transaction the metadata
+// collectors of the run share.
+type snapshot struct {
+	db       *sql.DB
+	dbConfig DatabaseConfig
+
+	batchOnce sync.Once
+	batchErr  error
+
+	statusOnce sync.Once
+	status     map[string]string
+	statusErr  error
+
+	variablesOnce sync.Once
+	variables     map[string]string
+	variablesErr  error
+
+	// conn holds the transaction of consistent_snapshot, started by the
+	// first collector reading metadata in the run
+	consistentOnce sync.Once
+	conn           *sql.Conn
+
+	// ctx ends at the timeout of the collector currently running
+	ctx context.Context
+}
+
+func newSnapshot(db *sql.DB, dbConfig DatabaseConfig) *snapshot {
+	return &snapshot{db: db, dbConfig: dbConfig, ctx: context.Background()}
+}
+
+// batched reports whether the status and variables were read together with
+// batch_queries. Servers without the performance_schema tables (before 5.7.6,
+// or with show_compatibility_56 enabled) fall back to the SHOW statements.
+func (s *snapshot) batched() bool {
+	if !s.dbConfig.BatchQueries {
+		return false
+	}
+	s.batchOnce.Do(func() {
+		s.status, s.variables, s.batchErr = queryStatusAndVariables(s.queryer())
+		if s.batchErr != nil {
+			logOnce("batch-queries:"+s.dbConfig.Name, "database %s: Error reading status and variables in one query, falling back to separate queries: %v", s.dbConfig.Name, s.batchErr)
+		}
+	})
+	return s.batchErr == nil
+}
+
+// globalStatus returns SHOW GLOBAL STATUS, querying it on first use
+func (s *snapshot) globalStatus() (map[string]string, error) {
+	if s.batched() {
+		return s.status, nil
+	}
+	s.statusOnce.Do(func() {
+		s.status, s.statusErr = queryGlobalStatus(s.queryer(), s.dbConfig)
+	})
+	return s.status, s.statusErr
+}
+
+// globalVariables returns SHOW GLOBAL VARIABLES, querying it on first use
+func (s *snapshot) globalVariables() (map[string]string, error) {
+	if s.batched() {
+		return s.variables, nil
+	}
+	s.variablesOnce.Do(func() {
+		s.variables, s.variablesErr = queryVariables(s.queryer(), s.dbConfig, "SHOW GLOBAL VARIABLES", "global_variables")
+	})
+	return s.variables, s.variablesErr
+}
+
+// queryer runs the queries of a collector, on a database or on a single
+// connection
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// contextQueryer is implemented by both *sql.DB and *sql.Conn
+type contextQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// runQueryer runs the queries of one collector run, which are canceled when
+// the run's context ends at its timeout
+type runQueryer struct {
+	db  contextQueryer
+	ctx context.Context
+}
+
+func (q runQueryer) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return q.db.QueryContext(q.ctx, query, args...)
+}
+
+func (q runQueryer) QueryRow(query string, args ...interface{}) *sql.Row {
+	return q.db.QueryRowContext(q.ctx, query, args...)
+}
+
+func (q runQueryer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return q.db.ExecContext(q.ctx, query, args...)
+}
+
+// QueryContext runs query until the first of ctx and the run's context ends
+func (q runQueryer) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return q.db.QueryContext(q.within(ctx), query, args...)
+}
+
+func (q runQueryer) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return q.db.QueryRowContext(q.within(ctx), query, args...)
+}
+
+// within returns ctx, also canceled when the run's context ends, which
+// always happens once the collector returns
+func (q runQueryer) within(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	context.AfterFunc(q.ctx, cancel)
+	return ctx
+}
+
+// consistentConn returns the connection whose transaction the metadata
+// collectors of the run share with consistent_snapshot, starting it on first
+// use. It is nil when consistent_snapshot is off or the transaction could
+// not be started.
+func (s *snapshot) consistentConn() *sql.Conn {
+	if !s.dbConfig.ConsistentSnapshot {
+		return nil
+	}
+	s.consistentOnce.Do(func() {
+		ctx := context.Background()
+		conn, err := s.db.Conn(ctx)
+		if err != nil {
+			log.Printf("database %s: Error acquiring connection for consistent snapshot: %v", s.dbConfig.Name, err)
+			return
+		}
+		// SET TRANSACTION applies to the next transaction only
+		_, err = conn.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+		if err == nil {
+			_, err = conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY")
+		}
+		if err != nil {
+			log.Printf("database %s: Error starting consistent snapshot, collecting without it: %v", s.dbConfig.Name, err)
+			conn.Close()
+			return
+		}
+		s.conn = conn
+	})
+	return s.conn
+}
+
+// queryer returns the database, bounded by the timeout of the running
+// collector
+func (s *snapshot) queryer() queryer {
+	return runQueryer{db: s.db, ctx: s.ctx}
+}
+
+// metadataQueryer returns the consistent snapshot connection when there is
+// one, and the database otherwise
+func (s *snapshot) metadataQueryer() queryer {
+	if conn := s.consistentConn(); conn != nil {
+		return runQueryer{db: conn, ctx: s.ctx}
+	}
+	return s.queryer()
+}
+
+// inSnapshot adapts a collector reading metadata to run in the consistent
+// snapshot of the run, if enabled
+func inSnapshot(collect func(db queryer, dbConfig DatabaseConfig)) func(s *snapshot) {
+	return func(s *snapshot) {
+		collect(s.metadataQueryer(), s.dbConfig)
+	}
+}
+
+// close ends the consistent snapshot transaction, if one was started. A
+// connection that could not end it is discarded rather than returned to the
+// pool with the transaction still open.
+func (s *snapshot) close() {
+	if s.conn == nil {
+		return
+	}
+	if _, err := s.conn.ExecContext(context.Background(), "ROLLBACK"); err != nil {
+		log.Printf("database %s: Error ending consistent snapshot: %v", s.dbConfig.Name, err)
+		s.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	s.conn.Close()
+	s.conn = nil
+}
+
+// queryStatusAndVariables reads the global status and variables from
+// performance_schema in a single round trip
+func queryStatusAndVariables(db queryer) (status, variables map[string]string, err error) {
+	rows, err := db.Query(`
+		SELECT 'status', variable_name, variable_value FROM performance_schema.global_status
+		UNION ALL
+		SELECT 'variables', variable_name, variable_value FROM performance_schema.global_variables
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	status = make(map[string]string)
+	variables = make(map[string]string)
+	for rows.Next() {
+		var source, name string
+		var value sql.NullString
+		if err := rows.Scan(&source, &name, &value); err != nil {
+			return nil, nil, err
+		}
+		if source == "status" {
+			status[name] = value.String
+		} else {
+			variables[name] = value.String
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return status, variables, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	sslAccepts = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_ssl_accepts_total",
+			Help: "Number of accepted SSL connection attempts (Ssl_accepts).",
+		},
+		labelNames(),
+	)
+	sslFinishedAccepts = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_ssl_finished_accepts_total",
+			Help: "Number of successful SSL connections to the server (Ssl_finished_accepts).",
+		},
+		labelNames(),
+	)
+	sslConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_ssl_connections",
+			Help: "Number of current client connections using SSL.",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(sslAccepts)
+	mustRegisterVec(sslFinishedAccepts)
+	mustRegisterVec(sslConnections)
+}
+
+// sslStatus maps the global status variables read by the ssl collector to
+// their counters. Servers built without SSL do not have them.
+var sslStatus = map[string]metricVec{
+	"Ssl_accepts":          sslAccepts,
+	"Ssl_finished_accepts": sslFinishedAccepts,
+}
+
+func collectSSL(s *snapshot) {
+	db, dbConfig := s.queryer(), s.dbConfig
+	cloudName := dbConfig.Name
+
+	queryStatusMetrics(s, "ssl", sslStatus)
+
+	// Ssl_cipher is empty for the threads of unencrypted connections
+	var connections int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM performance_schema.status_by_thread
+		WHERE variable_name = 'Ssl_cipher' AND variable_value <> ''
+	`).Scan(&connections)
+	if err != nil {
+		if isMissingObjectError(err) {
+			logOnce("ssl-connections-missing:"+cloudName, "database %s: performance_schema.status_by_thread not available, skipping mysql_ssl_connections", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing SSL connections query: %v", cloudName, err)
+		return
+	}
+	sslConnections.WithLabelValues(dbConfig.labelValues()...).Set(float64(connections))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricVec is a registered metric vec whose series can be deleted by label
+type metricVec interface {
+	prometheus.Collector
+	DeletePartialMatch(labels prometheus.Labels) int
+}
+
+// vecs holds every metric vec registered through mustRegisterVec
+var vecs []metricVec
+
+// collectors holds every collector waiting for registerMetrics
+var collectors []prometheus.Collector
+
+// mustRegisterCollector queues c for registration once the metric namespace
+// is known from the config
+func mustRegisterCollector(c prometheus.Collector) {
+	collectors = append(collectors, c)
+}
+
+// mustRegisterVec queues vec for registration and tracks it so the series
+// of a database can later be deleted by cloud_name
+func mustRegisterVec(vec metricVec) {
+	mustRegisterCollector(vec)
+	vecs = append(vecs, vec)
+}
+
+// metricPrefix is prepended to every metric name, from metric_namespace
+var metricPrefix string
+
+// registerMetrics registers every queued collector, prefixing all metric
+// names with namespace when it is set
+func registerMetrics(namespace string) error {
+	registerer := prometheus.DefaultRegisterer
+	if namespace != "" {
+		metricPrefix = namespace + "_"
+		registerer = prometheus.WrapRegistererWithPrefix(metricPrefix, registerer)
+	}
+	for _, c := range collectors {
+		if err := registerer.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seriesTracker records when each database was last collected and evicts
+// the series of databases that have not been collected within the ttl
+type seriesTracker struct {
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+}
+
+var series = &seriesTracker{lastSeen: make(map[string]time.Time)}
+
+// touch marks the database as still being collected
+func (t *seriesTracker) touch(cloudName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastSeen[cloudName] = time.Now()
+}
+
+// stateVecs are kept by evict: the health check keeps running while
+// collection is paused or suspended, so a down database still reports
+// mysql_up 0, and a paused one mysql_collection_paused 1
+var stateVecs = map[metricVec]bool{mysqlUp: true, circuitOpen: true, collectionPaused: true}
+
+// evict deletes every series of the database from all tracked metric vecs,
+// except those of its health check and pause state
+func (t *seriesTracker) evict(cloudName string) {
+	t.mu.Lock()
+	delete(t.lastSeen, cloudName)
+	t.mu.Unlock()
+
+	deleted := 0
+	for _, vec := range vecs {
+		if stateVecs[vec] {
+			continue
+		}
+		deleted += vec.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	}
+	pool.remove(cloudName)
+	allGlobalStatus.remove(cloudName)
+	innodbMetrics.remove(cloudName)
+	connectionAge.remove(cloudName)
+
+	forgetIdentity(cloudName)
+
+	lastUptimeMu.Lock()
+	delete(lastUptime, cloudName)
+	lastUptimeMu.Unlock()
+
+	lastAHICountsMu.Lock()
+	delete(lastAHICounts, cloudName)
+	lastAHICountsMu.Unlock()
+
+	emaMu.Lock()
+	for key := range emaValues {
+		if strings.Contains(key, "\xff"+cloudName+"\xff") {
+			delete(emaValues, key)
+		}
+	}
+	emaMu.Unlock()
+
+	log.Printf("database %s: evicted %d stale series", cloudName, deleted)
+}
+
+// forget evicts a database that is no longer collected at all, together
+// with its health check and pause series and its circuit breaker
+func (t *seriesTracker) forget(cloudName string) {
+	t.evict(cloudName)
+	for vec := range stateVecs {
+		vec.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	}
+
+	breakers.mu.Lock()
+	delete(breakers.states, cloudName)
+	breakers.mu.Unlock()
+}
+
+// sweep evicts databases last collected more than ttl ago
+func (t *seriesTracker) sweep(ttl time.Duration) {
+	t.mu.Lock()
+	var stale []string
+	for cloudName, seen := range t.lastSeen {
+		if time.Since(seen) > ttl {
+			stale = append(stale, cloudName)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, cloudName := range stale {
+		t.evict(cloudName)
+	}
+}
+
+// runStaleSweeper periodically evicts databases that stopped being collected
+func runStaleSweeper(ttl time.Duration) {
+	for {
+		time.Sleep(time.Minute)
+		series.sweep(ttl)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// seriesCount returns how many series of the collector carry the cloud_name
+func seriesCount(c prometheus.Collector, cloudName string) int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	count := 0
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+		for _, label := range pb.GetLabel() {
+			if label.GetName() == "cloud_name" && label.GetValue() == cloudName {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func TestSeriesTrackerSweepEvictsStaleDatabases(t *testing.T) {
+	stale := DatabaseConfig{Name: "stale"}
+	fresh := DatabaseConfig{Name: "fresh"}
+	schemaGrants.WithLabelValues(stale.labelValues("app", "SELECT")...).Set(2)
+	schemaGrants.WithLabelValues(fresh.labelValues("app", "SELECT")...).Set(3)
+	t.Cleanup(func() {
+		schemaGrants.DeletePartialMatch(prometheus.Labels{"cloud_name": fresh.Name})
+	})
+
+	// Stale was last collected before the ttl, fresh just now
+	tracker := &seriesTracker{lastSeen: map[string]time.Time{
+		stale.Name: time.Now().Add(-time.Hour),
+		fresh.Name: time.Now(),
+	}}
+	captureLog(t, func() { tracker.sweep(10 * time.Minute) })
+
+	if n := seriesCount(schemaGrants, stale.Name); n != 0 {
+		t.Errorf("stale database still has %d series", n)
+	}
+	if n := seriesCount(schemaGrants, fresh.Name); n != 1 {
+		t.Errorf("fresh database has %d series, want 1", n)
+	}
+	if _, ok := tracker.lastSeen[stale.Name]; ok {
+		t.Error("stale database is still tracked")
+	}
+	if _, ok := tracker.lastSeen[fresh.Name]; !ok {
+		t.Error("fresh database is no longer tracked")
+	}
+}
+
+func TestSeriesTrackerSweepKeepsStateSeries(t *testing.T) {
+	down := DatabaseConfig{Name: "down"}
+	mysqlUp.WithLabelValues(down.labelValues()...).Set(0)
+	circuitOpen.WithLabelValues(down.labelValues()...).Set(1)
+	schemaGrants.WithLabelValues(down.labelValues("app", "SELECT")...).Set(2)
+	t.Cleanup(func() {
+		mysqlUp.DeletePartialMatch(prometheus.Labels{"cloud_name": down.Name})
+		circuitOpen.DeletePartialMatch(prometheus.Labels{"cloud_name": down.Name})
+	})
+
+	tracker := &seriesTracker{lastSeen: map[string]time.Time{down.Name: time.Now().Add(-time.Hour)}}
+	captureLog(t, func() { tracker.sweep(10 * time.Minute) })
+
+	if n := seriesCount(schemaGrants, down.Name); n != 0 {
+		t.Errorf("down database still has %d schema grant series", n)
+	}
+	if got := collectedSeries(t, mysqlUp, down.Name); len(got) != 1 || got[""] != 0 {
+		t.Errorf("mysql_up = %v, want 0 to be kept", got)
+	}
+	if got := collectedSeries(t, circuitOpen, down.Name); len(got) != 1 || got[""] != 1 {
+		t.Errorf("mysql_circuit_open = %v, want 1 to be kept", got)
+	}
+}
+
+func TestRunEveryTouchesOnlyAfterCollecting(t *testing.T) {
+	const cloudName = "run-every-paused"
+	dbConfig := DatabaseConfig{Name: cloudName}
+	pauses.add(dbConfig)
+	t.Cleanup(func() {
+		pauses.remove(cloudName)
+		collectionPaused.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+		series.mu.Lock()
+		delete(series.lastSeen, cloudName)
+		series.mu.Unlock()
+	})
+	touched := func() bool {
+		series.mu.Lock()
+		defer series.mu.Unlock()
+		_, ok := series.lastSeen[cloudName]
+		return ok
+	}
+
+	// A closed done runs exactly one iteration
+	done := make(chan struct{})
+	close(done)
+	collected := 0
+	pauses.set(cloudName, true)
+	runEvery(cloudName, time.Hour, done, func(time.Time) { collected++ })
+	if ok := touched(); ok || collected != 0 {
+		t.Errorf("paused database was collected %d times and touched %v, want neither", collected, ok)
+	}
+
+	pauses.set(cloudName, false)
+	runEvery(cloudName, time.Hour, done, func(time.Time) { collected++ })
+	if ok := touched(); !ok || collected != 1 {
+		t.Errorf("resumed database was collected %d times and touched %v, want once and touched", collected, ok)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	statementErrors = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_errors_total",
+			Help: "Number of statements that raised an error since server start (performance_schema).",
+		},
+		labelNames(),
+	)
+	statementWarnings = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_warnings_total",
+			Help: "Number of warnings raised by statements since server start (performance_schema).",
+		},
+		labelNames(),
+	)
+	slowStatements = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_slow_statements",
+			Help: "Number of statement digests whose average latency exceeds the threshold (performance_schema).",
+		},
+		labelNames("threshold_seconds"),
+	)
+	slowStatementExecutions = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_slow_statement_executions_total",
+			Help: "Number of executions of the statement digests whose average latency exceeds the threshold, since the digests were first seen.",
+		},
+		labelNames("threshold_seconds"),
+	)
+)
+
+func init() {
+	mustRegisterVec(statementErrors)
+	mustRegisterVec(statementWarnings)
+	mustRegisterVec(slowStatements)
+	mustRegisterVec(slowStatementExecutions)
+}
+
+// SlowStatementsConfig configures the statement digests counted as slow
+type SlowStatementsConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// Threshold is the average latency above which a digest is slow.
+	// Defaults to 1s.
+	Threshold time.Duration `yaml:"threshold"`
+	// MaxDigests limits how many of the slowest digests are counted.
+	// Defaults to 1000.
+	MaxDigests int `yaml:"max_digests"`
+}
+
+func (c SlowStatementsConfig) threshold() time.Duration {
+	if c.Threshold <= 0 {
+		return time.Second
+	}
+	return c.Threshold
+}
+
+func (c SlowStatementsConfig) maxDigests() int {
+	if c.MaxDigests <= 0 {
+		return 1000
+	}
+	return c.MaxDigests
+}
+
+func collectStatementStats(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	// The sums are NULL when performance_schema is disabled, as the summary
+	// table then has no rows
+	var errorCount, warningCount sql.NullFloat64
+	err := db.QueryRow(`
+		SELECT SUM(sum_errors), SUM(sum_warnings)
+		FROM performance_schema.events_statements_summary_global_by_event_name
+	`).Scan(&errorCount, &warningCount)
+	if err != nil {
+		if isMissingObjectError(err) {
+			logOnce("statement-stats-missing:"+cloudName, "database %s: performance_schema statement statistics not available, skipping statement_stats", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing statement stats query: %v", cloudName, err)
+		return
+	}
+	if !errorCount.Valid {
+		logOnce("statement-stats-disabled:"+cloudName, "database %s: performance_schema is disabled, skipping statement_stats", cloudName)
+		return
+	}
+
+	statementErrors.set(dbConfig.labelValues(), errorCount.Float64)
+	statementWarnings.set(dbConfig.labelValues(), warningCount.Float64)
+}
+
+// collectSlowStatements approximates slow query activity from the digest
+// summary, without the slow query log
+func collectSlowStatements(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+	threshold := dbConfig.SlowStatements.threshold()
+
+	// AVG_TIMER_WAIT is in picoseconds
+	var digests int
+	var executions sql.NullFloat64
+	err := db.QueryRow(`
+		SELECT COUNT(*), SUM(count_star)
+		FROM (
+			SELECT count_star
+			FROM performance_schema.events_statements_summary_by_digest
+			WHERE avg_timer_wait > ?
+			ORDER BY avg_timer_wait DESC
+			LIMIT ?
+		) slow
+	`, threshold.Nanoseconds()*1000, dbConfig.SlowStatements.maxDigests()).Scan(&digests, &executions)
+	if err != nil {
+		if isMissingObjectError(err) {
+			logOnce("slow-statements-missing:"+cloudName, "database %s: performance_schema digest statistics not available, skipping slow_statements", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing slow statements query: %v", cloudName, err)
+		return
+	}
+
+	labels := dbConfig.labelValues(strconv.FormatFloat(threshold.Seconds(), 'f', -1, 64))
+	slowStatements.WithLabelValues(labels...).Set(float64(digests))
+	slowStatementExecutions.set(labels, executions.Float64)
+}
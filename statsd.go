@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// StatsDConfig sends the metrics to a StatsD server in the Datadog format,
+// with the labels as tags
+type StatsDConfig struct {
+	// Address is the host:port of the StatsD server, disabled when empty
+	Address string `yaml:"address"`
+	// Interval is how often the metrics are sent. Defaults to 1m.
+	Interval time.Duration `yaml:"interval"`
+	// Only stops serving /metrics, for setups without Prometheus
+	Only bool `yaml:"only"`
+}
+
+func (c StatsDConfig) interval() time.Duration {
+	if c.Interval <= 0 {
+		return time.Minute
+	}
+	return c.Interval
+}
+
+// Datagrams are kept below the usual Ethernet MTU to avoid fragmentation
+const statsdMaxDatagram = 1432
+
+// runStatsD sends the gathered metrics to the StatsD server every interval,
+// forever. Counters are sent as gauges holding their running total, as
+// StatsD counters expect increments.
+func runStatsD(c StatsDConfig) {
+	conn, err := net.Dial("udp", c.Address)
+	if err != nil {
+		log.Printf("statsd %s: Error connecting: %v", c.Address, err)
+		return
+	}
+	defer conn.Close()
+
+	for {
+		time.Sleep(c.interval())
+
+		families, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			log.Printf("statsd %s: Error gathering metrics: %v", c.Address, err)
+		}
+
+		var datagram bytes.Buffer
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				line, ok := statsdLine(family.GetName(), family.GetType(), metric)
+				if !ok {
+					continue
+				}
+				if datagram.Len() > 0 && datagram.Len()+1+len(line) > statsdMaxDatagram {
+					sendStatsD(conn, c.Address, datagram.Bytes())
+					datagram.Reset()
+				}
+				if datagram.Len() > 0 {
+					datagram.WriteByte('\n')
+				}
+				datagram.WriteString(line)
+			}
+		}
+		if datagram.Len() > 0 {
+			sendStatsD(conn, c.Address, datagram.Bytes())
+		}
+	}
+}
+
+func sendStatsD(conn net.Conn, address string, datagram []byte) {
+	if _, err := conn.Write(datagram); err != nil {
+		log.Printf("statsd %s: Error sending metrics: %v", address, err)
+	}
+}
+
+// statsdLine formats a metric as name:value|g|#label:value,... Histograms
+// and summaries are not sent.
+func statsdLine(name string, metricType dto.MetricType, metric *dto.Metric) (string, bool) {
+	var value float64
+	switch metricType {
+	case dto.MetricType_GAUGE:
+		value = metric.GetGauge().GetValue()
+	case dto.MetricType_COUNTER:
+		value = metric.GetCounter().GetValue()
+	case dto.MetricType_UNTYPED:
+		value = metric.GetUntyped().GetValue()
+	default:
+		return "", false
+	}
+
+	line := name + ":" + strconv.FormatFloat(value, 'g', -1, 64) + "|g"
+	tags := make([]string, 0, len(metric.GetLabel()))
+	for _, pair := range metric.GetLabel() {
+		if pair.GetValue() == "" {
+			continue
+		}
+		tags = append(tags, pair.GetName()+":"+statsdTagValue(pair.GetValue()))
+	}
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line, true
+}
+
+// statsdTagValue replaces the characters that separate tags and fields
+func statsdTagValue(value string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "\n", "_").Replace(value)
+}
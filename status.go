@@ -0,0 +1,314 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	uptime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_uptime_seconds",
+			Help: "Number of seconds the MySQL server has been up.",
+		},
+		labelNames(),
+	)
+	restartsDetected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_restart_detected_total",
+			Help: "Number of times the MySQL server uptime decreased between consecutive collections.",
+		},
+		labelNames(),
+	)
+)
+
+func init() {
+	mustRegisterVec(uptime)
+	mustRegisterVec(restartsDetected)
+	mustRegisterCollector(allGlobalStatus)
+}
+
+// globalStatusCollector exports every numeric SHOW GLOBAL STATUS variable of
+// the databases with collect_all_global_status enabled, and the per-second
+// rates of the counters of those with global_status_rates enabled. Metric
+// names are only known after querying, so the latest values are kept here
+// and turned into const metrics on each scrape.
+type globalStatusCollector struct {
+	mu        sync.Mutex
+	databases map[string]globalStatusValues
+}
+
+type globalStatusValues struct {
+	config DatabaseConfig
+	values map[string]float64
+	// at is when values were read, and rates holds the per-second change of
+	// the counters since the previous read
+	at    time.Time
+	rates map[string]float64
+}
+
+var allGlobalStatus = &globalStatusCollector{databases: make(map[string]globalStatusValues)}
+
+// Status variables that only ever increase until the server restarts or
+// FLUSH STATUS, by prefix and by name
+var (
+	counterStatusPrefixes = []string{
+		"Com_", "Handler_", "Bytes_", "Aborted_", "Created_tmp_", "Innodb_rows_",
+		"Select_", "Sort_", "Table_locks_", "Opened_",
+	}
+	counterStatusNames = map[string]bool{
+		"Questions": true, "Queries": true, "Connections": true, "Slow_queries": true,
+		"Threads_created": true, "Binlog_cache_use": true, "Binlog_cache_disk_use": true,
+		"Innodb_data_reads": true, "Innodb_data_writes": true, "Innodb_data_read": true, "Innodb_data_written": true,
+		"Innodb_buffer_pool_read_requests": true, "Innodb_buffer_pool_reads": true, "Innodb_buffer_pool_write_requests": true,
+		"Innodb_log_writes": true, "Innodb_os_log_written": true, "Innodb_row_lock_waits": true, "Innodb_row_lock_time": true,
+		"Key_reads": true, "Key_read_requests": true, "Key_writes": true, "Key_write_requests": true,
+	}
+)
+
+func isCounterStatus(name string) bool {
+	if counterStatusNames[name] {
+		return true
+	}
+	for _, prefix := range counterStatusPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// set replaces the status values of a database read at time at, computing
+// the counter rates against the previous values when enabled
+func (c *globalStatusCollector) set(dbConfig DatabaseConfig, status map[string]string, at time.Time) {
+	values := make(map[string]float64)
+	for name, value := range status {
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			values[name] = number
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current := globalStatusValues{config: dbConfig, values: values, at: at}
+	if previous, ok := c.databases[dbConfig.Name]; ok && dbConfig.GlobalStatusRates {
+		if elapsed := at.Sub(previous.at).Seconds(); elapsed > 0 {
+			current.rates = make(map[string]float64)
+			for name, value := range values {
+				last, ok := previous.values[name]
+				if !ok || !isCounterStatus(name) {
+					continue
+				}
+				// A counter that decreased was reset, by a restart or
+				// FLUSH STATUS, during the interval
+				rate := 0.0
+				if value >= last {
+					rate = (value - last) / elapsed
+				}
+				current.rates[name] = rate
+			}
+		}
+	}
+	c.databases[dbConfig.Name] = current
+}
+
+// remove stops exporting the status values of cloudName
+func (c *globalStatusCollector) remove(cloudName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.databases, cloudName)
+}
+
+// Describe sends no descriptors, making this an unchecked collector
+func (c *globalStatusCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *globalStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, database := range c.databases {
+		if database.config.CollectAllGlobalStatus {
+			for name, value := range database.values {
+				desc := prometheus.NewDesc(
+					"mysql_global_status_"+metricNameSuffix(name),
+					"Generic metric from SHOW GLOBAL STATUS.",
+					labelNames(), nil,
+				)
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.UntypedValue, value, database.config.labelValues()...)
+			}
+		}
+		for name, rate := range database.rates {
+			desc := prometheus.NewDesc(
+				"mysql_global_status_"+metricNameSuffix(name)+"_per_second",
+				"Per-second change of the SHOW GLOBAL STATUS counter between the last two collections.",
+				labelNames(), nil,
+			)
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, rate, database.config.labelValues()...)
+		}
+	}
+}
+
+// metricNameSuffix lowercases a status variable name and replaces characters
+// that are not valid in a metric name
+func metricNameSuffix(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// queryGlobalStatus returns SHOW GLOBAL STATUS as a map of variable name to value
+func queryGlobalStatus(db queryer, dbConfig DatabaseConfig) (map[string]string, error) {
+	return queryVariables(db, dbConfig, "SHOW GLOBAL STATUS", "global_status")
+}
+
+// queryVariables runs a SHOW STATUS or SHOW VARIABLES query and returns its
+// rows as a map of variable name to value
+func queryVariables(db queryer, dbConfig DatabaseConfig, query string, collector string) (map[string]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !checkColumns(rows, dbConfig, collector, "Variable_name", "Value") {
+		return nil, errColumnMismatch
+	}
+
+	status := make(map[string]string)
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		status[name] = value.String
+	}
+	return status, rows.Err()
+}
+
+// Uptime seen at the previous collection, keyed by cloud_name
+var (
+	lastUptimeMu sync.Mutex
+	lastUptime   = make(map[string]float64)
+)
+
+func collectGlobalStatus(s *snapshot) {
+	dbConfig := s.dbConfig
+	cloudName := dbConfig.Name
+
+	status, err := s.globalStatus()
+	if errors.Is(err, errColumnMismatch) {
+		return
+	}
+	if err != nil {
+		log.Printf("database %s: Error executing SHOW GLOBAL STATUS: %v", cloudName, err)
+		return
+	}
+
+	if value, err := strconv.ParseFloat(status["Uptime"], 64); err == nil {
+		uptime.WithLabelValues(dbConfig.labelValues()...).Set(value)
+
+		restarts := restartsDetected.WithLabelValues(dbConfig.labelValues()...)
+		lastUptimeMu.Lock()
+		if previous, ok := lastUptime[cloudName]; ok && value < previous {
+			log.Printf("database %s: Uptime decreased from %.0f to %.0f, server restarted", cloudName, previous, value)
+			restarts.Inc()
+			forgetIdentity(cloudName)
+		} else {
+			restarts.Add(0)
+		}
+		lastUptime[cloudName] = value
+		lastUptimeMu.Unlock()
+	}
+
+	if dbConfig.CollectAllGlobalStatus || dbConfig.GlobalStatusRates {
+		allGlobalStatus.set(dbConfig, status, time.Now())
+	}
+}
+
+// queryStatusValues reads the numeric global status variables in names.
+// Variables the server does not have are missing from the result.
+func queryStatusValues(db queryer, dbConfig DatabaseConfig, collector string, names ...string) (map[string]float64, error) {
+	// SHOW STATUS cannot be prepared, so the (constant) names are inlined
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+	rows, err := db.Query("SHOW GLOBAL STATUS WHERE Variable_name IN (" + strings.Join(quoted, ", ") + ")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !checkColumns(rows, dbConfig, collector, "Variable_name", "Value") {
+		return nil, errColumnMismatch
+	}
+
+	values := make(map[string]float64)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			values[name] = number
+		}
+	}
+	return values, rows.Err()
+}
+
+// queryStatusMetrics reads the global status variables named in metrics and
+// sets their gauge or server counter. Variables the server does not have are
+// skipped. With batch_queries they are read from the snapshot instead of
+// their own query.
+func queryStatusMetrics(s *snapshot, collector string, metrics map[string]metricVec) {
+	dbConfig := s.dbConfig
+
+	var values map[string]float64
+	var err error
+	if s.batched() {
+		status, _ := s.globalStatus()
+		values = make(map[string]float64)
+		for name := range metrics {
+			if number, err := strconv.ParseFloat(status[name], 64); err == nil {
+				values[name] = number
+			}
+		}
+	} else {
+		names := make([]string, 0, len(metrics))
+		for name := range metrics {
+			names = append(names, name)
+		}
+		values, err = queryStatusValues(s.queryer(), dbConfig, collector, names...)
+	}
+	if errors.Is(err, errColumnMismatch) {
+		return
+	}
+	if err != nil {
+		log.Printf("database %s: Error executing %s status query: %v", dbConfig.Name, collector, err)
+		return
+	}
+
+	for name, value := range values {
+		switch metric := metrics[name].(type) {
+		case *prometheus.GaugeVec:
+			metric.WithLabelValues(dbConfig.labelValues()...).Set(value)
+		case *serverCounterVec:
+			metric.set(dbConfig.labelValues(), value)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var tableCheckStatus = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_table_check_status",
+		Help: "Result of the last CHECK TABLE ... QUICK of the table, 1 for OK and 0 for an error described by message.",
+	},
+	labelNames("database", "table", "message"),
+)
+
+func init() {
+	mustRegisterVec(tableCheckStatus)
+}
+
+// Shortest interval allowed for table_check, as CHECK TABLE can lock the table
+const minTableCheckInterval = time.Hour
+
+// TableCheckConfig runs CHECK TABLE on a fixed list of tables
+type TableCheckConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// Tables are the tables to check, as schema.table. Whole schemas are
+	// never checked.
+	Tables []string `yaml:"tables"`
+}
+
+// validate requires an explicit table list and interval when enabled
+func (c TableCheckConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Tables) == 0 {
+		return errors.New("table_check: tables is required")
+	}
+	for _, table := range c.Tables {
+		if schema, name, ok := strings.Cut(table, "."); !ok || schema == "" || name == "" {
+			return fmt.Errorf("table_check: table %q is not schema.table", table)
+		}
+	}
+	if c.Interval < minTableCheckInterval {
+		return fmt.Errorf("table_check: interval must be set to at least %s", minTableCheckInterval)
+	}
+	return nil
+}
+
+func collectTableCheck(db queryer, dbConfig DatabaseConfig) {
+	for _, table := range dbConfig.TableCheck.Tables {
+		checkTable(db, dbConfig, table)
+	}
+}
+
+// checkTable runs CHECK TABLE ... QUICK, which reports on rows of type
+// status, error, warning or info. The table is OK unless an error is reported.
+func checkTable(db queryer, dbConfig DatabaseConfig, table string) {
+	cloudName := dbConfig.Name
+	schema, name, _ := strings.Cut(table, ".")
+
+	rows, err := db.Query("CHECK TABLE " + quoteIdentifier(table) + " QUICK")
+	if err != nil {
+		log.Printf("database %s: Error checking table %s: %v", cloudName, table, err)
+		return
+	}
+	defer rows.Close()
+
+	var message string
+	for rows.Next() {
+		var tableName, op, msgType, msgText string
+		if err := rows.Scan(&tableName, &op, &msgType, &msgText); err != nil {
+			log.Printf("database %s: Error scanning CHECK TABLE %s row: %v", cloudName, table, err)
+			return
+		}
+		if strings.EqualFold(msgType, "error") && message == "" {
+			message = msgText
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error checking table %s: %v", cloudName, table, err)
+		return
+	}
+
+	status := 1.0
+	if message != "" {
+		status = 0
+		log.Printf("database %s: CHECK TABLE %s failed: %s", cloudName, table, message)
+	}
+	tableCheckStatus.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName, "database": schema, "table": name})
+	tableCheckStatus.WithLabelValues(dbConfig.labelValues(schema, name, message)...).Set(status)
+}
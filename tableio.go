@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tableIORead = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_table_io_read_total",
+			Help: "Number of read I/O operations on the table since server start (performance_schema).",
+		},
+		labelNames("database", "table"),
+	)
+	tableIOWrite = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_table_io_write_total",
+			Help: "Number of write I/O operations on the table since server start (performance_schema).",
+		},
+		labelNames("database", "table"),
+	)
+)
+
+func init() {
+	mustRegisterVec(tableIORead)
+	mustRegisterVec(tableIOWrite)
+}
+
+// TableIOConfig configures the per-table I/O counters, used to find tables
+// nothing reads or writes
+type TableIOConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// TopTables limits each database to its largest tables. Defaults to 100.
+	TopTables int `yaml:"top_tables"`
+}
+
+func (c TableIOConfig) topTables() int {
+	if c.TopTables <= 0 {
+		return 100
+	}
+	return c.TopTables
+}
+
+func collectTableIO(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	rows, err := db.Query(`
+		SELECT io.object_schema, io.object_name, io.count_read, io.count_write
+		FROM performance_schema.table_io_waits_summary_by_table io
+		JOIN information_schema.tables t
+			ON t.table_schema = io.object_schema AND t.table_name = io.object_name
+		WHERE io.object_type = 'TABLE'
+		ORDER BY t.data_length + t.index_length DESC, io.object_schema, io.object_name
+	`)
+	if err != nil {
+		if isMissingObjectError(err) {
+			logOnce("table-io-missing:"+cloudName, "database %s: performance_schema table I/O statistics not available, skipping table_io", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing table I/O query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	// Rows are ordered by size across all databases, so the budget keeps
+	// the largest tables
+	topTables := dbConfig.TableIO.topTables()
+	perDatabase := make(map[string]int)
+	// Reads and writes by database and table labels
+	counts := make(map[[2]string][2]float64)
+	budget := newSeriesBudget(dbConfig, "table_io")
+	defer budget.done()
+
+	found := false
+	for rows.Next() {
+		var dbName, tableName string
+		var reads, writes float64
+
+		if err := rows.Scan(&dbName, &tableName, &reads, &writes); err != nil {
+			log.Printf("database %s: Error scanning table I/O row: %v", cloudName, err)
+			continue
+		}
+		found = true
+		if !dbConfig.schemaAllowed(dbName) {
+			continue
+		}
+		// Tables rewritten to the same labels are summed
+		dbName, tableName = dbConfig.rewriteTable(dbName, tableName)
+		key := [2]string{dbName, tableName}
+		if _, exported := counts[key]; !exported {
+			if perDatabase[dbName] >= topTables || !budget.allow() {
+				continue
+			}
+			perDatabase[dbName]++
+		}
+
+		c := counts[key]
+		counts[key] = [2]float64{c[0] + reads, c[1] + writes}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing table I/O query: %v", cloudName, err)
+		return
+	}
+
+	// Drop dropped tables and tables no longer among the largest
+	tableIORead.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	tableIOWrite.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for key, c := range counts {
+		tableIORead.set(dbConfig.labelValues(key[0], key[1]), c[0])
+		tableIOWrite.set(dbConfig.labelValues(key[0], key[1]), c[1])
+	}
+
+	// The summary has no rows while the wait/io/table/sql/handler
+	// instrument is disabled
+	if !found {
+		logOnce("table-io-empty:"+cloudName, "database %s: performance_schema table I/O statistics are empty, is the wait/io/table/sql/handler instrument enabled?", cloudName)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tablespaceAllocated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_innodb_tablespace_allocated_bytes",
+			Help: "Space actually allocated on disk for the InnoDB tablespace, in bytes.",
+		},
+		labelNames("space", "name"),
+	)
+	tablespaceFileSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_innodb_tablespace_file_size_bytes",
+			Help: "Apparent size of the InnoDB tablespace file, in bytes.",
+		},
+		labelNames("space", "name"),
+	)
+	undoTablespaceSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_innodb_undo_tablespace_bytes",
+			Help: "Size of the InnoDB undo tablespace file, in bytes.",
+		},
+		labelNames("space"),
+	)
+)
+
+func init() {
+	mustRegisterVec(tablespaceAllocated)
+	mustRegisterVec(tablespaceFileSize)
+	mustRegisterVec(undoTablespaceSize)
+}
+
+// queryTablespaces queries the InnoDB tablespace table, which is
+// INNODB_TABLESPACES on MySQL 8 and INNODB_SYS_TABLESPACES on 5.7
+func queryTablespaces(db queryer, columns string) (*sql.Rows, error) {
+	rows, err := db.Query("SELECT " + columns + " FROM information_schema.innodb_tablespaces")
+	if isMissingObjectError(err) {
+		rows, err = db.Query("SELECT " + columns + " FROM information_schema.innodb_sys_tablespaces")
+	}
+	return rows, err
+}
+
+func collectTablespaces(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	rows, err := queryTablespaces(db, "space, name, file_size, allocated_size")
+	if err != nil {
+		if isMissingObjectError(err) {
+			logOnce("tablespaces-missing:"+cloudName, "database %s: InnoDB tablespace table not available, skipping tablespaces", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing tablespace query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var space, name string
+		var fileSize, allocatedSize sql.NullFloat64
+
+		if err := rows.Scan(&space, &name, &fileSize, &allocatedSize); err != nil {
+			log.Printf("database %s: Error scanning tablespace row: %v", cloudName, err)
+			continue
+		}
+
+		tablespaceAllocated.WithLabelValues(dbConfig.labelValues(space, name)...).Set(allocatedSize.Float64)
+		tablespaceFileSize.WithLabelValues(dbConfig.labelValues(space, name)...).Set(fileSize.Float64)
+	}
+}
+
+// isUnknownColumnError reports whether err is MySQL's "unknown column" error.
+func isUnknownColumnError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1054
+}
+
+func collectUndoTablespaces(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	// Undo tablespaces are listed with space_type 'Undo' since MySQL 8.0.14.
+	// Older servers keep undo logs in the system tablespace or do not list
+	// them, and have no space_type column.
+	rows, err := db.Query("SELECT name, file_size FROM information_schema.innodb_tablespaces WHERE space_type = 'Undo'")
+	if err != nil {
+		if isMissingObjectError(err) || isUnknownColumnError(err) {
+			logOnce("undo-tablespaces-missing:"+cloudName, "database %s: undo tablespaces not listed by this server, skipping undo tablespaces", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing undo tablespace query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var fileSize sql.NullFloat64
+
+		if err := rows.Scan(&name, &fileSize); err != nil {
+			log.Printf("database %s: Error scanning undo tablespace row: %v", cloudName, err)
+			continue
+		}
+
+		undoTablespaceSize.WithLabelValues(dbConfig.labelValues(name)...).Set(fileSize.Float64)
+	}
+}
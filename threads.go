@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var threadCPU = newServerCounterVec(
+	prometheus.CounterOpts{
+		Name: "mysql_thread_cpu_seconds_total",
+		Help: "CPU time spent executing statements per thread since it started, for the threads with the most CPU time.",
+	},
+	labelNames("thread_id", "user"),
+)
+
+func init() {
+	mustRegisterVec(threadCPU)
+}
+
+// ThreadCPUConfig configures per-thread statement CPU time
+type ThreadCPUConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// TopThreads limits the metrics to the threads with the most CPU time.
+	// Defaults to 20.
+	TopThreads int `yaml:"top_threads"`
+}
+
+func (c ThreadCPUConfig) topThreads() int {
+	if c.TopThreads <= 0 {
+		return 20
+	}
+	return c.TopThreads
+}
+
+// collectThreadCPU reads the statement CPU time of each thread, which MySQL
+// 8.0.28+ only measures while the events_statements_cpu consumer is enabled
+func collectThreadCPU(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	var enabled string
+	err := db.QueryRow("SELECT enabled FROM performance_schema.setup_consumers WHERE name = 'events_statements_cpu'").Scan(&enabled)
+	if err == sql.ErrNoRows || isMissingObjectError(err) {
+		logOnce("thread-cpu-missing:"+cloudName, "database %s: performance_schema statement CPU time not available (needs MySQL 8.0.28+), skipping thread_cpu", cloudName)
+		return
+	}
+	if err != nil {
+		log.Printf("database %s: Error reading events_statements_cpu consumer: %v", cloudName, err)
+		return
+	}
+	if enabled != "YES" {
+		logOnce("thread-cpu-disabled:"+cloudName, "database %s: consumer events_statements_cpu is disabled, skipping thread_cpu", cloudName)
+		return
+	}
+
+	// SUM_CPU_TIME is in picoseconds. Background threads have a NULL user.
+	rows, err := db.Query(`
+		SELECT s.thread_id, t.processlist_user, SUM(s.sum_cpu_time) / 1e12 AS cpu
+		FROM performance_schema.events_statements_summary_by_thread_by_event_name s
+		JOIN performance_schema.threads t ON t.thread_id = s.thread_id
+		GROUP BY s.thread_id, t.processlist_user
+		HAVING cpu > 0
+		ORDER BY cpu DESC
+		LIMIT ?
+	`, dbConfig.ThreadCPU.topThreads())
+	if err != nil {
+		if isUnknownColumnError(err) {
+			logOnce("thread-cpu-missing:"+cloudName, "database %s: performance_schema statement CPU time not available (needs MySQL 8.0.28+), skipping thread_cpu", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing thread CPU query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	// Threads exit and drop out of the top N, so only the current ones are
+	// exported
+	threadCPU.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+
+	for rows.Next() {
+		var threadID int64
+		var user sql.NullString
+		var cpu float64
+
+		if err := rows.Scan(&threadID, &user, &cpu); err != nil {
+			log.Printf("database %s: Error scanning thread CPU row: %v", cloudName, err)
+			continue
+		}
+
+		userName := user.String
+		if !user.Valid {
+			userName = "BACKGROUND"
+		}
+		threadCPU.set(dbConfig.labelValues(strconv.FormatInt(threadID, 10), userName), cpu)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TLSConfig configures TLS for the connections to a database. Certificate
+// files are re-read when they change or on SIGHUP.
+type TLSConfig struct {
+	CAFile   string `yaml:"ca_file"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName defaults to the host of the DSN
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+func (c TLSConfig) enabled() bool {
+	return c.CAFile != "" || c.CertFile != "" || c.InsecureSkipVerify
+}
+
+// WebTLSConfig serves /metrics over HTTPS when set. The certificate is
+// re-read when it changes or on SIGHUP.
+type WebTLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// tlsFiles is a set of certificate files loaded together, reloaded when any
+// of them changes
+type tlsFiles struct {
+	name   string
+	files  []string
+	load   func() error
+	loaded time.Time
+}
+
+// tlsReloaderRegistry holds the certificate files to reload, keyed by name.
+// Discovered databases are added and removed while the reloader runs.
+type tlsReloaderRegistry struct {
+	mu    sync.Mutex
+	files map[string]*tlsFiles
+}
+
+var tlsReloaders = &tlsReloaderRegistry{files: make(map[string]*tlsFiles)}
+
+// list returns the registered files
+func (r *tlsReloaderRegistry) list() []*tlsFiles {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := make([]*tlsFiles, 0, len(r.files))
+	for _, f := range r.files {
+		files = append(files, f)
+	}
+	return files
+}
+
+// remove stops reloading the files registered under name
+func (r *tlsReloaderRegistry) remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.files, name)
+}
+
+// watch loads the files and registers them for reloading, replacing the
+// files previously registered under the same name
+func (f *tlsFiles) watch() error {
+	f.loaded = time.Now()
+	if err := f.load(); err != nil {
+		return err
+	}
+	tlsReloaders.mu.Lock()
+	defer tlsReloaders.mu.Unlock()
+	tlsReloaders.files[f.name] = f
+	return nil
+}
+
+// changed reports whether any of the files was modified since the last load
+func (f *tlsFiles) changed() bool {
+	for _, file := range f.files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(f.loaded) {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadTLS reloads the certificates that changed, or all of them when
+// force is set. A failed reload keeps the previous certificates.
+func reloadTLS(force bool) {
+	for _, f := range tlsReloaders.list() {
+		if !force && !f.changed() {
+			continue
+		}
+		f.loaded = time.Now()
+		if err := f.load(); err != nil {
+			log.Printf("%s: WARN Error reloading TLS certificates, keeping the previous ones: %v", f.name, err)
+			continue
+		}
+		log.Printf("%s: reloaded TLS certificates", f.name)
+	}
+}
+
+// runTLSReloader reloads changed certificates every minute and all of them
+// on SIGHUP, forever
+func runTLSReloader() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(time.Minute)
+	for {
+		select {
+		case <-hup:
+			reloadTLS(true)
+		case <-ticker.C:
+			reloadTLS(false)
+		}
+	}
+}
+
+// clientTLS holds the current certificates of a database. The tls.Config
+// registered with the driver only refers to it through callbacks, so new
+// connections use reloaded certificates while established ones are kept.
+type clientTLS struct {
+	config     TLSConfig
+	serverName string
+	// commonName is checked instead of serverName for Cloud SQL, whose
+	// server certificates name the instance in the subject only
+	commonName string
+
+	mu    sync.RWMutex
+	roots *x509.CertPool
+	cert  *tls.Certificate
+}
+
+func (c *clientTLS) load() error {
+	var roots *x509.CertPool
+	if c.config.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.config.CAFile)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", c.config.CAFile)
+		}
+	}
+
+	var cert *tls.Certificate
+	if c.config.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(c.config.CertFile, c.config.KeyFile)
+		if err != nil {
+			return err
+		}
+		cert = &pair
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roots = roots
+	c.cert = cert
+	return nil
+}
+
+func (c *clientTLS) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.cert == nil {
+		return &tls.Certificate{}, nil
+	}
+	return c.cert, nil
+}
+
+// verifyConnection verifies the server certificate against the current CA,
+// or the system roots when no ca_file is set
+func (c *clientTLS) verifyConnection(state tls.ConnectionState) error {
+	if c.config.InsecureSkipVerify {
+		return nil
+	}
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server sent no certificate")
+	}
+
+	c.mu.RLock()
+	roots := c.roots
+	c.mu.RUnlock()
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	leaf := state.PeerCertificates[0]
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       c.serverName,
+	})
+	if err == nil && c.commonName != "" && leaf.Subject.CommonName != c.commonName {
+		err = fmt.Errorf("server certificate is for %q, not %q", leaf.Subject.CommonName, c.commonName)
+	}
+	return err
+}
+
+// registerClientTLS registers the database's TLS config with the driver and
+// returns the DSN parameter selecting it
+func registerClientTLS(dbConfig DatabaseConfig) (string, error) {
+	if err := validateClientTLS(dbConfig); err != nil {
+		return "", err
+	}
+
+	c := &clientTLS{config: dbConfig.TLS, serverName: dbConfig.TLS.ServerName}
+	if cfg, err := mysql.ParseDSN(dbConfig.DSN); err == nil {
+		if c.serverName == "" {
+			if host, _, err := net.SplitHostPort(cfg.Addr); err == nil {
+				c.serverName = host
+			}
+		}
+		// Accounts created with REQUIRE X509/SUBJECT can authenticate with
+		// the certificate alone, where a password is usually a leftover
+		if cfg.Passwd != "" && dbConfig.TLS.CertFile != "" {
+			log.Printf("database %s: both a DSN password and a client certificate are set; the server checks both if the account requires a certificate, otherwise only the password", dbConfig.Name)
+		}
+	}
+
+	// Cloud SQL certificates are signed by a per-instance CA (ca_file) for
+	// the instance connection name, e.g. "project:instance", set as
+	// server_name
+	if dbConfig.Provider == providerGCP {
+		c.serverName, c.commonName = "", dbConfig.TLS.ServerName
+	}
+
+	files := &tlsFiles{name: clientTLSName(dbConfig), load: c.load}
+	for _, file := range []string{dbConfig.TLS.CAFile, dbConfig.TLS.CertFile, dbConfig.TLS.KeyFile} {
+		if file != "" {
+			files.files = append(files.files, file)
+		}
+	}
+	if err := files.watch(); err != nil {
+		return "", err
+	}
+
+	// Verification is done by verifyConnection so that the CA can change
+	key := clientTLSKey(dbConfig)
+	err := mysql.RegisterTLSConfig(key, &tls.Config{
+		InsecureSkipVerify:   true,
+		GetClientCertificate: c.getClientCertificate,
+		VerifyConnection:     c.verifyConnection,
+	})
+	if err != nil {
+		return "", err
+	}
+	return "tls=" + url.QueryEscape(key), nil
+}
+
+// validateClientTLS checks the tls settings of a database, other than its
+// certificate files
+func validateClientTLS(dbConfig DatabaseConfig) error {
+	if (dbConfig.TLS.CertFile == "") != (dbConfig.TLS.KeyFile == "") {
+		return errors.New("cert_file and key_file must be set together")
+	}
+	if dbConfig.Provider == providerGCP && dbConfig.TLS.CAFile == "" && !dbConfig.TLS.InsecureSkipVerify {
+		return errors.New("provider gcp needs ca_file, the instance's server-ca.pem")
+	}
+	return nil
+}
+
+// checkClientTLS loads the certificates of a database without registering
+// them, to check a config before it replaces the running one
+func checkClientTLS(dbConfig DatabaseConfig) error {
+	if !dbConfig.TLS.enabled() {
+		return nil
+	}
+	if err := validateClientTLS(dbConfig); err != nil {
+		return err
+	}
+	return (&clientTLS{config: dbConfig.TLS}).load()
+}
+
+// unregisterClientTLS stops reloading the certificates of a removed
+// database and deregisters its TLS config from the driver
+func unregisterClientTLS(dbConfig DatabaseConfig) {
+	if !dbConfig.TLS.enabled() {
+		return
+	}
+	tlsReloaders.remove(clientTLSName(dbConfig))
+	mysql.DeregisterTLSConfig(clientTLSKey(dbConfig))
+}
+
+// clientTLSName is the name the database's certificates are reloaded under
+func clientTLSName(dbConfig DatabaseConfig) string {
+	return "database " + dbConfig.Name
+}
+
+// clientTLSKey is the name of the database's TLS config in the driver
+func clientTLSKey(dbConfig DatabaseConfig) string {
+	return "exporter-" + dbConfig.Name
+}
+
+// serverCertificate holds the current certificate of the HTTPS listener
+type serverCertificate struct {
+	config WebTLSConfig
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func (c *serverCertificate) load() error {
+	pair, err := tls.LoadX509KeyPair(c.config.CertFile, c.config.KeyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &pair
+	return nil
+}
+
+func (c *serverCertificate) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// serverTLS returns the tls.Config of the HTTPS listener, or nil when
+// web_tls is not set
+func serverTLS(config WebTLSConfig) (*tls.Config, error) {
+	if config.CertFile == "" {
+		return nil, nil
+	}
+	c := &serverCertificate{config: config}
+	files := &tlsFiles{name: "web", files: []string{config.CertFile, config.KeyFile}, load: c.load}
+	if err := files.watch(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{GetCertificate: c.getCertificate}, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// writeCertificate writes a self-signed certificate and its key to dir and
+// returns their paths
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "db.example.com"},
+		DNSNames:              []string{"db.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTargetDSNRegistersClientTLS(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+	dbConfig := DatabaseConfig{
+		Name: "tls-test",
+		DSN:  "exporter@tcp(db.example.com:3306)/",
+		TLS:  TLSConfig{CAFile: certFile, CertFile: certFile, KeyFile: keyFile},
+	}
+	t.Cleanup(func() { unregisterClientTLS(dbConfig) })
+
+	dsn, err := targetDSN(dbConfig)
+	if err != nil {
+		t.Fatalf("targetDSN() error: %v", err)
+	}
+	if !strings.Contains(dsn, "&tls=exporter-tls-test") {
+		t.Fatalf("DSN %q does not select the registered TLS config", dsn)
+	}
+
+	// The driver only parses a tls parameter naming a registered config
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("driver rejects DSN %q: %v", dsn, err)
+	}
+	if cfg.TLS == nil || cfg.TLS.GetClientCertificate == nil {
+		t.Error("driver did not resolve the registered TLS config")
+	}
+	if !tlsReloaderRegistered(clientTLSName(dbConfig)) {
+		t.Error("certificates are not registered for reloading")
+	}
+
+	unregisterClientTLS(dbConfig)
+	if _, err := mysql.ParseDSN(dsn); err == nil {
+		t.Error("TLS config is still registered with the driver after unregisterClientTLS")
+	}
+	if tlsReloaderRegistered(clientTLSName(dbConfig)) {
+		t.Error("certificates are still reloaded after unregisterClientTLS")
+	}
+}
+
+func TestOpenTargetRejectsBadTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.pem")
+
+	tests := []struct {
+		name string
+		tls  TLSConfig
+	}{
+		{"missing ca_file", TLSConfig{CAFile: missing}},
+		{"ca_file without certificates", TLSConfig{CAFile: notPEM}},
+		{"missing cert_file", TLSConfig{CAFile: certFile, CertFile: missing, KeyFile: keyFile}},
+		{"missing key_file", TLSConfig{CAFile: certFile, CertFile: certFile, KeyFile: missing}},
+		{"cert_file without key_file", TLSConfig{CAFile: certFile, CertFile: certFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbConfig := DatabaseConfig{
+				Name: "bad-tls",
+				DSN:  "exporter@tcp(db.example.com:3306)/",
+				TLS:  tt.tls,
+			}
+			if _, err := openTarget(dbConfig); err == nil || !strings.HasPrefix(err.Error(), "tls: ") {
+				t.Errorf("openTarget() error = %v, want a tls error", err)
+			}
+			if tlsReloaderRegistered(clientTLSName(dbConfig)) {
+				t.Error("certificates that failed to load are registered for reloading")
+			}
+		})
+	}
+}
+
+// tlsReloaderRegistered reports whether certificates are reloaded under name
+func tlsReloaderRegistered(name string) bool {
+	for _, f := range tlsReloaders.list() {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
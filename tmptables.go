@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tmpTablesCreated = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_created_tmp_tables_total",
+			Help: "Number of internal temporary tables created while executing statements (Created_tmp_tables).",
+		},
+		labelNames(),
+	)
+	tmpDiskTablesCreated = newServerCounterVec(
+		prometheus.CounterOpts{
+			Name: "mysql_created_tmp_disk_tables_total",
+			Help: "Number of internal temporary tables created on disk (Created_tmp_disk_tables).",
+		},
+		labelNames(),
+	)
+	tmpDiskTableRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_tmp_disk_table_ratio",
+			Help: "Ratio of internal temporary tables created on disk to all internal temporary tables. A high ratio suggests tmp_table_size is too small.",
+		},
+		labelNames(),
+	)
+	tmpTableSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_tmp_table_size_bytes",
+			Help: "Maximum size of in-memory internal temporary tables (tmp_table_size).",
+		},
+		labelNames(),
+	)
+	maxHeapTableSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_max_heap_table_size_bytes",
+			Help: "Maximum size of MEMORY tables (max_heap_table_size), which also caps in-memory temporary tables.",
+		},
+		labelNames(),
+	)
+	openTempTables = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_open_temp_tables",
+			Help: "Number of user-created InnoDB temporary tables currently open in all sessions (information_schema.innodb_temp_table_info).",
+		},
+		labelNames(),
+	)
+	sessionOpenTempTables = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_session_open_temp_tables",
+			Help: "Number of temporary tables the session has open, for the sessions with the most (performance_schema.table_handles).",
+		},
+		labelNames("thread_id", "user"),
+	)
+)
+
+func init() {
+	mustRegisterVec(tmpTablesCreated)
+	mustRegisterVec(tmpDiskTablesCreated)
+	mustRegisterVec(tmpDiskTableRatio)
+	mustRegisterVec(tmpTableSize)
+	mustRegisterVec(maxHeapTableSize)
+	mustRegisterVec(openTempTables)
+	mustRegisterVec(sessionOpenTempTables)
+}
+
+// collectTmpTables derives the temporary table metrics from the cycle's
+// snapshot, so the ratio matches the status metrics of the same cycle
+func collectTmpTables(s *snapshot) {
+	dbConfig := s.dbConfig
+	cloudName := dbConfig.Name
+	labels := dbConfig.labelValues()
+
+	variables, err := s.globalVariables()
+	if err != nil && !errors.Is(err, errColumnMismatch) {
+		log.Printf("database %s: Error executing SHOW GLOBAL VARIABLES: %v", cloudName, err)
+	}
+	if value, err := strconv.ParseFloat(variables["tmp_table_size"], 64); err == nil {
+		tmpTableSize.WithLabelValues(labels...).Set(value)
+	}
+	if value, err := strconv.ParseFloat(variables["max_heap_table_size"], 64); err == nil {
+		maxHeapTableSize.WithLabelValues(labels...).Set(value)
+	}
+
+	// global_status already logged a failed status query
+	status, err := s.globalStatus()
+	if err != nil {
+		return
+	}
+	total, err := strconv.ParseFloat(status["Created_tmp_tables"], 64)
+	if err != nil {
+		return
+	}
+	disk, _ := strconv.ParseFloat(status["Created_tmp_disk_tables"], 64)
+	tmpTablesCreated.set(labels, total)
+	tmpDiskTablesCreated.set(labels, disk)
+	// No temporary tables since startup leaves the ratio undefined
+	if total > 0 {
+		tmpDiskTableRatio.WithLabelValues(labels...).Set(disk / total)
+	}
+}
+
+// Temporary tables are only exported per session for the sessions with the
+// most open
+const topTempTableSessions = 20
+
+// collectOpenTempTables counts the temporary tables currently open, unlike
+// Created_tmp_tables which counts those ever created, so sessions that keep
+// creating temporary tables without dropping them can be found.
+// Created_tmp_tables has no counterpart counting the dropped tables, so the
+// count is read from InnoDB, which holds the temporary tables created with
+// CREATE TEMPORARY TABLE. Internal temporary tables of running statements are
+// not included.
+func collectOpenTempTables(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	var total float64
+	err := db.QueryRow("SELECT COUNT(*) FROM information_schema.innodb_temp_table_info").Scan(&total)
+	if isMissingObjectError(err) {
+		logOnce("temp-tables-missing:"+cloudName, "database %s: information_schema.innodb_temp_table_info not available, skipping open_temp_tables", cloudName)
+		return
+	}
+	if err != nil {
+		log.Printf("database %s: Error executing open temporary tables query: %v", cloudName, err)
+		return
+	}
+	openTempTables.WithLabelValues(dbConfig.labelValues()...).Set(total)
+
+	collectSessionTempTables(db, dbConfig)
+}
+
+// collectSessionTempTables breaks the open temporary tables down by session,
+// from the table handles performance_schema instruments. Without it only the
+// total is exported.
+func collectSessionTempTables(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	rows, err := db.Query(`
+		SELECT h.owner_thread_id, COALESCE(t.processlist_user, ''), COUNT(*) AS tables
+		FROM performance_schema.table_handles h
+		JOIN performance_schema.threads t ON t.thread_id = h.owner_thread_id
+		WHERE h.object_type = 'TEMPORARY TABLE'
+		GROUP BY h.owner_thread_id, t.processlist_user
+		ORDER BY tables DESC
+		LIMIT ?
+	`, topTempTableSessions)
+	if isMissingObjectError(err) || isAccessDeniedError(err) {
+		logOnce("temp-tables-sessions:"+cloudName, "database %s: performance_schema.table_handles not available, skipping per-session open temporary tables", cloudName)
+		return
+	}
+	if err != nil {
+		log.Printf("database %s: Error executing session temporary tables query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	// Drop the sessions that closed their temporary tables or ended
+	sessionOpenTempTables.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for rows.Next() {
+		var threadID, user string
+		var tables float64
+		if err := rows.Scan(&threadID, &user, &tables); err != nil {
+			log.Printf("database %s: Error scanning session temporary tables row: %v", cloudName, err)
+			return
+		}
+		sessionOpenTempTables.WithLabelValues(dbConfig.labelValues(threadID, user)...).Set(tables)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error executing session temporary tables query: %v", cloudName, err)
+	}
+}
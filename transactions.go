@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	openTransactions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_open_transactions",
+			Help: "Number of open InnoDB transactions per user, for the users with the oldest transactions.",
+		},
+		labelNames("user"),
+	)
+	oldestTransaction = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mysql_oldest_transaction_seconds",
+			Help: "Age of the oldest open InnoDB transaction per user, in seconds.",
+		},
+		labelNames("user"),
+	)
+)
+
+func init() {
+	mustRegisterVec(openTransactions)
+	mustRegisterVec(oldestTransaction)
+}
+
+const topTransactionUsers = 20
+
+// isAccessDeniedError reports whether err is one of MySQL's "access denied"
+// or "requires privilege" errors.
+func isAccessDeniedError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1044 || mysqlErr.Number == 1142 || mysqlErr.Number == 1227
+	}
+	return false
+}
+
+func collectTransactions(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	// trx_mysql_thread_id is the processlist id of the session owning the
+	// transaction; transactions whose session is gone have no user
+	rows, err := db.Query(`
+		SELECT processlist.user, COUNT(*), MAX(TIMESTAMPDIFF(SECOND, trx.trx_started, NOW())) AS age
+		FROM information_schema.innodb_trx trx
+		LEFT JOIN `+dbConfig.processlistTable()+` ON processlist.id = trx.trx_mysql_thread_id
+		GROUP BY processlist.user
+		ORDER BY age DESC
+		LIMIT ?
+	`, topTransactionUsers)
+	if err != nil {
+		if isAccessDeniedError(err) {
+			logOnce("transactions-denied:"+cloudName, "database %s: PROCESS privilege required for information_schema.innodb_trx, skipping transactions", cloudName)
+			return
+		}
+		log.Printf("database %s: Error executing open transactions query: %v", cloudName, err)
+		return
+	}
+	defer rows.Close()
+
+	// Transactions end, so only the users with open ones are exported
+	openTransactions.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	oldestTransaction.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+
+	for rows.Next() {
+		var user sql.NullString
+		var count int
+		var age sql.NullFloat64
+
+		if err := rows.Scan(&user, &count, &age); err != nil {
+			log.Printf("database %s: Error scanning open transactions row: %v", cloudName, err)
+			continue
+		}
+
+		userStr := "UNKNOWN_USER"
+		if user.Valid && user.String != "" {
+			userStr = user.String
+		}
+		openTransactions.WithLabelValues(dbConfig.labelValues(userStr)...).Set(float64(count))
+		oldestTransaction.WithLabelValues(dbConfig.labelValues(userStr)...).Set(age.Float64)
+	}
+}
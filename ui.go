@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Number of largest tables shown per database on the status page
+const statusPageTables = 3
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>mysql_info_exporter</title></head>
+<body>
+<h1>mysql_info_exporter</h1>
+<p><a href="/metrics">Metrics</a> &middot; <a href="/config">Config</a></p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>cloud_name</th><th>Status</th><th>Last scrape</th><th>Version</th><th>Largest tables</th></tr>
+{{range .}}<tr>
+<td>{{.Name}}</td>
+<td>{{.Status}}</td>
+<td>{{if .LastScrape.IsZero}}never{{else}}{{.LastScrape.Format "2006-01-02 15:04:05 MST"}}{{end}}</td>
+<td>{{.Version}}</td>
+<td>{{range .Tables}}{{.Name}} ({{.Size}})<br>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type statusPageRow struct {
+	Name       string
+	Status     string
+	LastScrape time.Time
+	Version    string
+	Tables     []statusPageTable
+}
+
+type statusPageTable struct {
+	Name  string
+	Size  string
+	bytes float64
+}
+
+// statusPageRows builds the status page from the gathered metrics, one row
+// per cloud_name
+func statusPageRows(families []*dto.MetricFamily) []*statusPageRow {
+	rows := make(map[string]*statusPageRow)
+	row := func(metric *dto.Metric) (*statusPageRow, map[string]string) {
+		labels := make(map[string]string)
+		for _, pair := range metric.GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		r, ok := rows[labels["cloud_name"]]
+		if !ok {
+			r = &statusPageRow{Name: labels["cloud_name"], Status: "-"}
+			rows[r.Name] = r
+		}
+		return r, labels
+	}
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch family.GetName() {
+			case metricPrefix + "mysql_up":
+				r, _ := row(metric)
+				r.Status = "down"
+				if metric.GetGauge().GetValue() == 1 {
+					r.Status = "up"
+				}
+			case metricPrefix + "mysql_last_scrape_timestamp_seconds":
+				r, _ := row(metric)
+				if t := time.Unix(int64(metric.GetGauge().GetValue()), 0); t.After(r.LastScrape) {
+					r.LastScrape = t
+				}
+			case metricPrefix + "mysql_version_info":
+				r, labels := row(metric)
+				r.Version = labels["version"]
+			case metricPrefix + "mysql_table_size_bytes":
+				r, labels := row(metric)
+				size := metric.GetGauge().GetValue()
+				r.Tables = append(r.Tables, statusPageTable{Name: labels["database"] + "." + labels["table"], Size: formatBytes(size), bytes: size})
+			}
+		}
+	}
+
+	result := make([]*statusPageRow, 0, len(rows))
+	for _, r := range rows {
+		sort.Slice(r.Tables, func(i, j int) bool { return r.Tables[i].bytes > r.Tables[j].bytes })
+		if len(r.Tables) > statusPageTables {
+			r.Tables = r.Tables[:statusPageTables]
+		}
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// formatBytes formats a size with a binary unit, such as 1.5 GiB
+func formatBytes(size float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f B", size)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
+
+// statusPageHandler serves /, a read-only HTML overview of the databases
+func statusPageHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		families, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			log.Printf("Error gathering metrics for the status page: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusPageTemplate.Execute(w, statusPageRows(families)); err != nil {
+			log.Printf("Error rendering the status page: %v", err)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	vitessShardInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vitess_shard_info",
+			Help: "Shard known to the VTGate, value is always 1.",
+		},
+		labelNames("keyspace", "shard"),
+	)
+	vitessShardTablets = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vitess_shard_tablets",
+			Help: "Number of tablets of the shard seen by the VTGate, by tablet type and serving state.",
+		},
+		labelNames("keyspace", "shard", "tablet_type", "state"),
+	)
+)
+
+func init() {
+	mustRegisterVec(vitessShardInfo)
+	mustRegisterVec(vitessShardTablets)
+}
+
+// collectVitess reads the shards and tablets a VTGate routes to. VTGate
+// speaks the MySQL protocol but proxies or rejects most server queries, so
+// only the Vitess SHOW statements are used.
+func collectVitess(db queryer, dbConfig DatabaseConfig) {
+	cloudName := dbConfig.Name
+
+	shards, err := queryRowMaps(db, "SHOW vitess_shards")
+	if err != nil {
+		log.Printf("database %s: Error executing SHOW vitess_shards: %v", cloudName, err)
+	} else {
+		vitessShardInfo.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+		for _, row := range shards {
+			// Shards are listed as keyspace/shard
+			keyspace, shard, _ := strings.Cut(row["shards"], "/")
+			vitessShardInfo.WithLabelValues(dbConfig.labelValues(keyspace, shard)...).Set(1)
+		}
+	}
+
+	tablets, err := queryRowMaps(db, "SHOW vitess_tablets")
+	if err != nil {
+		log.Printf("database %s: Error executing SHOW vitess_tablets: %v", cloudName, err)
+		return
+	}
+
+	type tabletKey struct{ keyspace, shard, tabletType, state string }
+	counts := make(map[tabletKey]int)
+	for _, row := range tablets {
+		counts[tabletKey{row["keyspace"], row["shard"], strings.ToLower(row["tablettype"]), row["state"]}]++
+	}
+
+	vitessShardTablets.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName})
+	for key, count := range counts {
+		vitessShardTablets.WithLabelValues(dbConfig.labelValues(key.keyspace, key.shard, key.tabletType, key.state)...).Set(float64(count))
+	}
+}
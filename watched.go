@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var watchedRows = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mysql_watched_rows",
+		Help: "Number of rows of a watched table matching its where clause, by the value of its label column.",
+	},
+	labelNames("table", "label"),
+)
+
+func init() {
+	mustRegisterVec(watchedRows)
+}
+
+// WatchedTableConfig counts the rows of a table matching a condition, such
+// as the pending jobs of a queue table
+type WatchedTableConfig struct {
+	// Table is the table to count, as schema.table
+	Table string `yaml:"table"`
+	// Where is an SQL condition, all rows are counted when empty
+	Where string `yaml:"where"`
+	// LabelColumn groups the count by the column's value, exported in the
+	// label named label
+	LabelColumn string `yaml:"label_column"`
+	// Timeout cancels the count after this long. Defaults to 5s.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c WatchedTableConfig) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return c.Timeout
+}
+
+// query returns the count query. MAX_EXECUTION_TIME stops the query on the
+// server even if the cancelled connection is not noticed, and is ignored
+// before MySQL 5.7.8.
+func (c WatchedTableConfig) query() string {
+	label := "''"
+	if c.LabelColumn != "" {
+		label = quoteIdentifier(c.LabelColumn)
+	}
+	schema, name, _ := strings.Cut(c.Table, ".")
+	table := quoteIdentifier(schema) + "." + quoteIdentifier(name)
+	query := fmt.Sprintf("SELECT /*+ MAX_EXECUTION_TIME(%d) */ %s, COUNT(*) FROM %s", c.timeout().Milliseconds(), label, table)
+	if c.Where != "" {
+		query += " WHERE " + c.Where
+	}
+	if c.LabelColumn != "" {
+		query += " GROUP BY " + label
+	}
+	return query
+}
+
+// validateWatchedTables checks that every watched table is named once, as
+// schema.table, and that label_column is a single column
+func validateWatchedTables(tables []WatchedTableConfig) error {
+	seen := make(map[string]bool)
+	for _, t := range tables {
+		if t.Table == "" {
+			return errors.New("watched_tables: table is required")
+		}
+		if schema, name, ok := strings.Cut(t.Table, "."); !ok || schema == "" || name == "" || strings.Contains(name, ".") {
+			return fmt.Errorf("watched_tables: table %q is not schema.table", t.Table)
+		}
+		if strings.Contains(t.LabelColumn, ".") {
+			return fmt.Errorf("watched_tables: label_column %q of table %s is not a column name", t.LabelColumn, t.Table)
+		}
+		if seen[t.Table] {
+			return fmt.Errorf("watched_tables: table %q is listed twice", t.Table)
+		}
+		seen[t.Table] = true
+	}
+	return nil
+}
+
+func collectWatchedTables(db queryer, dbConfig DatabaseConfig) {
+	for _, t := range dbConfig.WatchedTables {
+		collectWatchedTable(db, dbConfig, t)
+	}
+}
+
+func collectWatchedTable(db queryer, dbConfig DatabaseConfig, t WatchedTableConfig) {
+	cloudName := dbConfig.Name
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout())
+	defer cancel()
+
+	start := time.Now()
+	rows, err := db.QueryContext(ctx, t.query())
+	if err != nil {
+		log.Printf("database %s: Error counting watched table %s: %v", cloudName, t.Table, err)
+		return
+	}
+	defer rows.Close()
+
+	counts := make(map[string]float64)
+	for rows.Next() {
+		var label sql.NullString
+		var count float64
+		if err := rows.Scan(&label, &count); err != nil {
+			log.Printf("database %s: Error scanning watched table %s row: %v", cloudName, t.Table, err)
+			return
+		}
+		counts[label.String] += count
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("database %s: Error counting watched table %s: %v", cloudName, t.Table, err)
+		return
+	}
+
+	// A count taking over half its timeout is most likely scanning the table
+	if elapsed := time.Since(start); elapsed > t.timeout()/2 {
+		logOnce("watched-slow:"+cloudName+":"+t.Table, "database %s: WARN counting watched table %s took %s; check that the where clause and label_column are indexed",
+			cloudName, t.Table, elapsed.Round(time.Millisecond))
+	}
+
+	watchedRows.DeletePartialMatch(prometheus.Labels{"cloud_name": cloudName, "table": t.Table})
+	for label, count := range counts {
+		watchedRows.WithLabelValues(dbConfig.labelValues(t.Table, label)...).Set(count)
+	}
+}
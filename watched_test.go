@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestWatchedTableQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		config WatchedTableConfig
+		want   string
+	}{
+		{
+			"count",
+			WatchedTableConfig{Table: "app.jobs"},
+			"SELECT /*+ MAX_EXECUTION_TIME(5000) */ '', COUNT(*) FROM `app`.`jobs`",
+		},
+		{
+			"where and label column",
+			WatchedTableConfig{Table: "app.jobs", Where: "state = 'pending'", LabelColumn: "queue"},
+			"SELECT /*+ MAX_EXECUTION_TIME(5000) */ `queue`, COUNT(*) FROM `app`.`jobs` WHERE state = 'pending' GROUP BY `queue`",
+		},
+		{
+			"backticks in identifiers",
+			WatchedTableConfig{Table: "app.jo`bs", LabelColumn: "que`ue"},
+			"SELECT /*+ MAX_EXECUTION_TIME(5000) */ `que``ue`, COUNT(*) FROM `app`.`jo``bs` GROUP BY `que``ue`",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.query(); got != tt.want {
+				t.Errorf("query() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateWatchedTables(t *testing.T) {
+	tests := []struct {
+		name    string
+		tables  []WatchedTableConfig
+		wantErr bool
+	}{
+		{"valid", []WatchedTableConfig{{Table: "app.jobs", LabelColumn: "queue"}}, false},
+		{"missing table", []WatchedTableConfig{{}}, true},
+		{"no schema", []WatchedTableConfig{{Table: "jobs"}}, true},
+		{"empty schema", []WatchedTableConfig{{Table: ".jobs"}}, true},
+		{"empty table", []WatchedTableConfig{{Table: "app."}}, true},
+		{"three parts", []WatchedTableConfig{{Table: "app.jobs.x"}}, true},
+		{"qualified label column", []WatchedTableConfig{{Table: "app.jobs", LabelColumn: "jobs.queue"}}, true},
+		{"listed twice", []WatchedTableConfig{{Table: "app.jobs"}, {Table: "app.jobs"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateWatchedTables(tt.tables); (err != nil) != tt.wantErr {
+				t.Errorf("validateWatchedTables() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}